@@ -1,16 +1,21 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	hdrhistogram "github.com/HdrHistogram/hdrhistogram-go"
 	"github.com/RediSearch/RediSearchBenchmark/index"
+	"github.com/RediSearch/RediSearchBenchmark/ingest"
 	"github.com/RediSearch/RediSearchBenchmark/query"
+	"github.com/RediSearch/RediSearchBenchmark/synth"
 	"io"
 	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -20,23 +25,49 @@ import (
 
 // SearchBenchmark returns a closure of a function for the benchmarker to run, using a given index
 // and options, on a set of queries
-func SearchBenchmark(queries []string, field string, idx index.Index, opts interface{}, debug int) func() error {
+func SearchBenchmark(queries []string, field string, idx index.Index, opts interface{}, debug int) func() (string, error) {
 	counter := 0
-	return func() error {
+	return func() (string, error) {
 		q := query.NewQuery(idx.GetName(), queries[counter%len(queries)]).Limit(0, 5).SetField(field)
 		_, _, err := idx.FullTextQuerySingleField(*q, debug)
 		counter++
-		return err
+		return BENCHMARK_SEARCH, err
 	}
 }
 
-func SuffixBenchmark(terms []string, field string, idx index.Index, prefixMinLen, prefixMaxLen int64, debug int) func() error {
+// SearchFilteredBenchmark returns a closure of a function for the benchmarker to run, combining the queries with a
+// random window of the integer filterField, like a timestamp. The windows span windowRatio of the min to max range
+func SearchFilteredBenchmark(queries []string, field string, idx index.Index, opts interface{}, filterField string, min, max, windowRatio float64, debug int) func() (string, error) {
+	counter := 0
+	window := (max - min) * windowRatio
+	return func() (string, error) {
+		from := min + rand.Float64()*(max-min-window)
+		q := query.NewQuery(idx.GetName(), queries[counter%len(queries)]).Limit(0, 5).SetField(field).
+			AddPredicate(query.InRange(filterField, int64(from), int64(from+window), true))
+		_, _, err := idx.FullTextQuerySingleField(*q, debug)
+		counter++
+		return BENCHMARK_SEARCH_FILTERED, err
+	}
+}
+
+// GeoBenchmark returns a closure of a function for the benchmarker to run, querying the documents within radiusKm
+// kilometers of random locations
+func GeoBenchmark(field string, idx index.Index, locations *synth.LocationGenerator, radiusKm float64, debug int) func() (string, error) {
+	return func() (string, error) {
+		center := locations.Generate()
+		q := query.NewQuery(idx.GetName(), "").Limit(0, 5).AddPredicate(query.WithinRadius(field, center.Lon, center.Lat, radiusKm))
+		_, _, err := idx.FullTextQuerySingleField(*q, debug)
+		return BENCHMARK_GEO, err
+	}
+}
+
+func SuffixBenchmark(terms []string, field string, idx index.Index, prefixMinLen, prefixMaxLen int64, debug int) func() (string, error) {
 	counter := 0
 	fixedPrefixSize := false
 	if prefixMinLen == prefixMaxLen {
 		fixedPrefixSize = true
 	}
-	return func() error {
+	return func() (string, error) {
 		term := terms[counter%len(terms)]
 		var prefixSize int64 = prefixMinLen
 		if !fixedPrefixSize {
@@ -51,17 +82,17 @@ func SuffixBenchmark(terms []string, field string, idx index.Index, prefixMinLen
 		q := query.NewQuery(idx.GetName(), term).Limit(0, 5).SetFlags(query.QueryTypeSuffix).SetField(field)
 		_, _, err := idx.SuffixQuery(*q, debug)
 		counter++
-		return err
+		return BENCHMARK_SUFFIX, err
 	}
 }
 
-func ContainsBenchmark(terms []string, field string, idx index.Index, prefixMinLen, prefixMaxLen int64, debug int) func() error {
+func ContainsBenchmark(terms []string, field string, idx index.Index, prefixMinLen, prefixMaxLen int64, debug int) func() (string, error) {
 	counter := 0
 	fixedPrefixSize := false
 	if prefixMinLen == prefixMaxLen {
 		fixedPrefixSize = true
 	}
-	return func() error {
+	return func() (string, error) {
 		term := terms[counter%len(terms)]
 		var prefixSize int64 = prefixMinLen
 		if !fixedPrefixSize {
@@ -78,19 +109,19 @@ func ContainsBenchmark(terms []string, field string, idx index.Index, prefixMinL
 		q := query.NewQuery(idx.GetName(), term).Limit(0, 5).SetField(field)
 		_, _, err := idx.ContainsQuery(*q, debug)
 		counter++
-		return err
+		return BENCHMARK_CONTAINS, err
 	}
 }
 
 // SearchBenchmark returns a closure of a function for the benchmarker to run, using a given index
 // and options, on a set of queries
-func PrefixBenchmark(terms []string, field string, idx index.Index, prefixMinLen, prefixMaxLen int64, debug int) func() error {
+func PrefixBenchmark(terms []string, field string, idx index.Index, prefixMinLen, prefixMaxLen int64, debug int) func() (string, error) {
 	counter := 0
 	fixedPrefixSize := false
 	if prefixMinLen == prefixMaxLen {
 		fixedPrefixSize = true
 	}
-	return func() error {
+	return func() (string, error) {
 		term := terms[counter%len(terms)]
 		var prefixSize int64 = prefixMinLen
 		if !fixedPrefixSize {
@@ -105,15 +136,15 @@ func PrefixBenchmark(terms []string, field string, idx index.Index, prefixMinLen
 		q := query.NewQuery(idx.GetName(), term).Limit(0, 5).SetFlags(query.QueryTypePrefix).SetField(field)
 		_, _, err := idx.PrefixQuery(*q, debug)
 		counter++
-		return err
+		return BENCHMARK_PREFIX, err
 	}
 }
 
 // SearchBenchmark returns a closure of a function for the benchmarker to run, using a given index
 // and options, on a set of queries
-func WildcardBenchmark(terms []string, field string, idx index.Index, prefixMinLen, prefixMaxLen int64, debug int) func() error {
+func WildcardBenchmark(terms []string, field string, idx index.Index, prefixMinLen, prefixMaxLen int64, debug int) func() (string, error) {
 	counter := 0
-	return func() error {
+	return func() (string, error) {
 		term := terms[counter%len(terms)]
 		var prefixSize int64 = prefixMinLen
 		n := rand.Int63n(int64(prefixMaxLen - prefixMinLen))
@@ -129,19 +160,74 @@ func WildcardBenchmark(terms []string, field string, idx index.Index, prefixMinL
 		q := query.NewQuery(idx.GetName(), term).Limit(0, 5).SetField(field)
 		_, _, err := idx.WildCardQuery(*q, debug)
 		counter++
-		return err
+		return BENCHMARK_WILDCARD, err
+	}
+}
+
+// ParseMixedWeights parses a comma separated list of query type=weight pairs, like search=70,prefix=20,wildcard=10
+func ParseMixedWeights(spec string) (map[string]int64, error) {
+	weights := map[string]int64{}
+	for _, pair := range strings.Split(spec, ",") {
+		kv := strings.Split(pair, "=")
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("expected a query type=weight pair but got '%s'", pair)
+		}
+		kv[0], kv[1] = strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		weight, err := strconv.ParseInt(kv[1], 10, 64)
+		if err != nil || weight <= 0 {
+			return nil, fmt.Errorf("the weight of %s needs to be a positive integer but got '%s'", kv[0], kv[1])
+		}
+		if _, ok := weights[kv[0]]; ok {
+			return nil, fmt.Errorf("the weight of %s is set more than once", kv[0])
+		}
+		weights[kv[0]] = weight
+	}
+	return weights, nil
+}
+
+// MixedBenchmark returns a closure of a function for the benchmarker to run, that on each call picks one of the given
+// benchmarks with a probability proportional to its weight.
+func MixedBenchmark(benchmarks map[string]func() (string, error), weights map[string]int64) func() (string, error) {
+	queryTypes := make([]string, 0, len(weights))
+	for queryType := range weights {
+		queryTypes = append(queryTypes, queryType)
+	}
+	// keep the order stable so that a given seed produces the same sequence of queries
+	sort.Strings(queryTypes)
+	cumulativeWeights := make([]int64, len(queryTypes))
+	totalWeight := int64(0)
+	for i, queryType := range queryTypes {
+		totalWeight += weights[queryType]
+		cumulativeWeights[i] = totalWeight
+	}
+	return func() (string, error) {
+		n := rand.Int63n(totalWeight)
+		i := sort.Search(len(cumulativeWeights), func(i int) bool { return cumulativeWeights[i] > n })
+		return benchmarks[queryTypes[i]]()
 	}
 }
 
 // Benchmark runs a given function f for the given duration, and outputs the throughput and latency of the function.
+// The latency is also recorded per the command name f returns on every call.
 //
-// It receives metadata like the engine we are running and the title of the specific benchmark, and writes these along
-// with the results to a CSV file given by outfile.
+// If warmup is larger than 0, f is first run for the warmup duration without recording the results, so that the caches
+// of the engines are warm once the measurements start.
+//
+// If maxRps is larger than 0 the benchmark runs open-loop: requests are issued at a fixed global rate of maxRps
+// requests per second, spread across the workers. Otherwise each worker calls f back to back.
+//
+// Failed requests are counted per error class. Once more than errorBudget requests failed the benchmark is aborted,
+// the results are still stored, and the error is returned. A negative errorBudget means no limit.
+//
+// It receives metadata like the engine we are running, the title of the specific benchmark and the engine specific
+// configuration dbConfigs, and writes these along with the results to a CSV file given by outfile.
 //
 // If outfile is "-" we write the result to stdout
-func Benchmark(concurrency int, duration time.Duration, instantMutex *sync.Mutex, engine, title string, outfile string, reportingPeriod time.Duration, tab *tabwriter.Writer, f func() error) {
-	totalHistogram = hdrhistogram.New(1, 1000000000, 3)
-
+//
+// Once ctx is done the workers stop issuing new requests, the in-flight ones are completed, and the partial results are
+// stored and marked as interrupted. The results of a benchmark aborted by the error budget are marked as interrupted
+// too, along with the abort reason.
+func Benchmark(ctx context.Context, concurrency int, duration time.Duration, warmup time.Duration, maxRps int64, errorBudget int64, instantMutex *sync.Mutex, engine, title string, dbConfigs map[string]interface{}, outfile string, reportingPeriod time.Duration, tab *tabwriter.Writer, f func() (string, error)) error {
 	var out io.WriteCloser
 	var err error
 	if outfile == "-" {
@@ -153,59 +239,208 @@ func Benchmark(concurrency int, duration time.Duration, instantMutex *sync.Mutex
 		}
 		defer out.Close()
 	}
-	startTime := time.Now()
-	endTime := startTime.Add(duration)
-	wg := sync.WaitGroup{}
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	if reportingPeriod.Nanoseconds() > 0 {
-		go report(reportingPeriod, startTime, endTime, tab)
+	// the first error that aborted the benchmark
+	var abortErr error
+	var abortOnce sync.Once
+	benchmarkRequest := func(intended time.Time) {
+		if err := runRequest(f, instantMutex, intended); err != nil {
+			if err = recordError(err, errorBudget); err != nil {
+				abortOnce.Do(func() {
+					abortErr = err
+					cancel()
+				})
+			}
+		}
 	}
 
-	for i := 0; i < concurrency; i++ {
-		wg.Add(1)
-		go func() {
-			for time.Now().Before(endTime) {
+	testMaxRps := int64(-1)
+	if maxRps > 0 {
+		log.Println(fmt.Sprintf("Issuing requests at a fixed rate of %d requests per second", maxRps))
+		testMaxRps = maxRps
+	}
 
-				tst := time.Now()
+	if warmup > 0 {
+		// the warm-up requests are recorded in histograms and counters that are thrown away once it's done, so their
+		// errors don't count against the error budget
+		log.Println(fmt.Sprintf("Warming up for %s before starting the measurements.", warmup.String()))
+		resetStats(maxRps > 0)
+		warmupStart := time.Now()
+		runWorkers(runCtx, concurrency, maxRps, warmupStart, warmupStart.Add(warmup), func(intended time.Time) {
+			if err := runRequest(f, instantMutex, intended); err != nil {
+				recordError(err, -1)
+			}
+		})
+		if failed := atomic.LoadUint64(&totalErrors); failed > 0 {
+			log.Println(fmt.Sprintf("%d requests failed during the warm-up.", failed))
+		}
+	}
 
-				if err = f(); err != nil {
-					panic(err)
-				}
-				instantMutex.Lock()
-				err = totalHistogram.RecordValue(time.Since(tst).Microseconds())
-				if err != nil {
-					panic(err)
-				}
-				instantMutex.Unlock()
-				// update the total requests performed and total time
-				atomic.AddUint64(&totalOps, 1)
-				atomic.AddUint64(&totalTime, uint64(time.Since(tst)))
+	resetStats(maxRps > 0)
+	startTime := time.Now()
+	endTime := startTime.Add(duration)
 
-			}
-			wg.Done()
-		}()
+	reportDone := make(chan struct{})
+	if reportingPeriod.Nanoseconds() > 0 {
+		go report(reportingPeriod, startTime, endTime, tab, reportDone)
 	}
-	wg.Wait()
+	runWorkers(runCtx, concurrency, maxRps, startTime, endTime, benchmarkRequest)
+	close(reportDone)
 	took := endTime.Sub(startTime)
+	interrupted := ctx.Err() != nil
+	if abortErr != nil || interrupted {
+		if elapsed := time.Since(startTime); elapsed < took {
+			took = elapsed
+			endTime = startTime.Add(took)
+		}
+	}
+	abortReason := ""
+	if abortErr != nil {
+		abortReason = abortErr.Error()
+	}
 	// keep this due to the \r
 	fmt.Println("")
-	log.Println(fmt.Sprintf("Finished the benchmark after %s.", took.String()))
+	switch {
+	case abortErr != nil:
+		log.Println(fmt.Sprintf("Aborted the benchmark after %s: %v", took.String(), abortErr))
+	case interrupted:
+		log.Println(fmt.Sprintf("Interrupted the benchmark after %s.", took.String()))
+		abortErr = fmt.Errorf("the benchmark was interrupted after %s", took.String())
+	default:
+		log.Println(fmt.Sprintf("Finished the benchmark after %s.", took.String()))
+	}
+
+	testResult := TestResult{
+		Metadata:             "",
+		ResultFormatVersion:  CurrentResultFormatVersion,
+		Limit:                0,
+		Workers:              uint(concurrency),
+		MaxRps:               testMaxRps,
+		WarmupDurationMillis: warmup.Milliseconds(),
+		Interrupted:          interrupted || abortErr != nil,
+		AbortReason:          abortReason,
+		DBSpecificConfigs:    dbConfigs,
+		StartTime:            startTime.Unix() * 1000,
+		EndTime:              endTime.Unix() * 1000,
+		DurationMillis:       took.Milliseconds(),
+		Totals:               GetTotals(),
+		OverallRates:         GetOverallRatesMap(took),
+		OverallQuantiles:     GetOverallQuantiles(),
+		TimeSeries:           GetTimeSeries(),
+	}
+	storeTestResult(outfile, testResult)
+	return abortErr
+}
+
+// IngestionBenchmark ingests the documents read from fileName into idx, and measures it like Benchmark does: the
+// latency of each batch of documents is recorded, and the indexed documents and bytes rates, the time-series, the total
+// documents and the index size are stored in outfile.
+//
+// It returns the error of ingest.ReadFile, so documents that failed to be indexed don't stop the ingestion.
+func IngestionBenchmark(fileName string, reader ingest.DocumentReader, idx index.Index, opts interface{}, chunk int, maxDocs int64, indexingWorkers int, instantMutex *sync.Mutex, dbConfigs map[string]interface{}, outfile string, reportingPeriod time.Duration) error {
+	resetStats(false)
+	startTime := time.Now()
+	reportDone := make(chan struct{})
+	if reportingPeriod.Nanoseconds() > 0 {
+		go reportIngestion(reportingPeriod, startTime, reportDone)
+	}
+	err := ingest.ReadFile(fileName, reader, idx, opts, chunk, maxDocs, indexingWorkers, func(batch []index.Document, took time.Duration, err error) {
+		recordBatch(batch, took, err, instantMutex)
+	}, reportingPeriod)
+	if flushErr := idx.Flush(); flushErr != nil {
+		log.Println(fmt.Sprintf("Failed to flush the index due to %v", flushErr))
+		if err == nil {
+			err = flushErr
+		}
+	}
+	close(reportDone)
+	took := time.Since(startTime)
+	endTime := startTime.Add(took)
+	log.Println(fmt.Sprintf("Finished the ingestion of %d documents after %s.", atomic.LoadUint64(&totalDocs), took.String()))
+
+	totals := GetTotals()
+	totals["totalDocs"] = totalDocs
+	totals["totalBytes"] = totalBytes
+	if indexSize, sizeErr := idx.IndexSize(); sizeErr != nil {
+		log.Println(fmt.Sprintf("Failed to retrieve the index size due to %v", sizeErr))
+	} else {
+		totals["indexSizeBytes"] = indexSize
+	}
+	if statsIdx, ok := idx.(index.StatsIndex); ok {
+		for name, stats := range statsIdx.IndexingStats() {
+			totals[name] = stats
+		}
+	}
+	overallRates := GetOverallRatesMap(took)
+	overallRates["overallDocsRate"] = calculateRateMetrics(totalDocs, 0, took)
+	overallRates["overallBytesRate"] = calculateRateMetrics(totalBytes, 0, took)
 
 	testResult := TestResult{
 		Metadata:            "",
 		ResultFormatVersion: CurrentResultFormatVersion,
-		Limit:               0,
-		Workers:             uint(concurrency),
+		Limit:               uint64(maxDocs),
+		Workers:             uint(indexingWorkers),
 		MaxRps:              -1,
-		DBSpecificConfigs:   nil,
+		DBSpecificConfigs:   dbConfigs,
 		StartTime:           startTime.Unix() * 1000,
 		EndTime:             endTime.Unix() * 1000,
 		DurationMillis:      took.Milliseconds(),
-		Totals:              nil,
-		OverallRates:        GetOverallRatesMap(took),
+		Totals:              totals,
+		OverallRates:        overallRates,
 		OverallQuantiles:    GetOverallQuantiles(),
-		TimeSeries:          nil,
+		TimeSeries:          GetTimeSeries(),
+	}
+	storeTestResult(outfile, testResult)
+	return err
+}
+
+// recordBatch records the latency of a batch of documents indexed during an ingestion, and accounts the documents and
+// bytes that were indexed. A batch that failed is counted as a single error
+func recordBatch(batch []index.Document, took time.Duration, err error, instantMutex *sync.Mutex) {
+	failed := map[string]bool{}
+	if err != nil {
+		recordError(err, -1)
+		var indexingErr *index.IndexingError
+		if !errors.As(err, &indexingErr) {
+			return
+		}
+		for _, docErr := range indexingErr.Failed {
+			failed[docErr.Id] = true
+		}
 	}
+	docs := uint64(0)
+	bytes := uint64(0)
+	for _, doc := range batch {
+		if !failed[doc.Id] {
+			docs++
+			bytes += uint64(doc.EstimatedSize())
+		}
+	}
+	atomic.AddUint64(&totalDocs, docs)
+	atomic.AddUint64(&totalBytes, bytes)
+	if err != nil {
+		return
+	}
+	instantMutex.Lock()
+	err = totalHistogram.RecordValue(took.Microseconds())
+	if err == nil {
+		err = intervalHistogram.RecordValue(took.Microseconds())
+	}
+	if err == nil {
+		err = recordCommandLatency(COMMAND_INDEX, took.Microseconds())
+	}
+	instantMutex.Unlock()
+	if err != nil {
+		panic(err)
+	}
+	atomic.AddUint64(&totalOps, 1)
+	atomic.AddUint64(&totalTime, uint64(took))
+}
+
+// storeTestResult writes the test result as JSON to outfile. If outfile is empty the result is not stored
+func storeTestResult(outfile string, testResult TestResult) {
 	if strings.Compare(outfile, "") != 0 {
 		log.Println(fmt.Sprintf("Storing the benchmark results in %s", outfile))
 		file, err := json.MarshalIndent(testResult, "", " ")
@@ -218,5 +453,180 @@ func Benchmark(concurrency int, duration time.Duration, instantMutex *sync.Mutex
 			log.Fatal(err)
 		}
 	}
+}
+
+// runWorkers runs benchmarkRequest on concurrency workers from startTime until endTime or until ctx is done, and waits
+// for all the workers to finish.
+// If maxRps is larger than 0 the requests are issued by the requestScheduler, otherwise each worker issues them back
+// to back.
+func runWorkers(ctx context.Context, concurrency int, maxRps int64, startTime, endTime time.Time, benchmarkRequest func(intended time.Time)) {
+	var requests chan time.Time
+	if maxRps > 0 {
+		requests = make(chan time.Time, concurrency)
+		go requestScheduler(ctx, maxRps, startTime, endTime, requests)
+	}
 
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if requests != nil {
+				for intended := range requests {
+					if ctx.Err() != nil {
+						return
+					}
+					benchmarkRequest(intended)
+				}
+				return
+			}
+			for time.Now().Before(endTime) && ctx.Err() == nil {
+				benchmarkRequest(time.Now())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// RunWriters starts writers go-routines that index the documents received from docs, one document per call to
+// idx.Index, for the given duration or until ctx is done or docs is closed. If maxRps is larger than 0 the documents
+// are indexed at a fixed global rate of maxRps documents per second, spread across the writers.
+//
+// The latency of each write is recorded in the histogram of the COMMAND_INDEX command, while failed writes are
+// counted apart from the failed queries. On an index.AsyncIndex a write completes once it was sent to the server, so
+// the writes still buffered when the index is flushed or closed are recorded then.
+// The returned WaitGroup is done once all the writers returned.
+func RunWriters(ctx context.Context, writers int, duration time.Duration, maxRps int64, docs <-chan index.Document, idx index.Index, opts interface{}, instantMutex *sync.Mutex) *sync.WaitGroup {
+	startTime := time.Now()
+	endTime := startTime.Add(duration)
+	var requests chan time.Time
+	if maxRps > 0 {
+		requests = make(chan time.Time, writers)
+		go requestScheduler(ctx, maxRps, startTime, endTime, requests)
+	}
+
+	outOfDocs := sync.Once{}
+	wg := &sync.WaitGroup{}
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(endTime) && ctx.Err() == nil {
+				var intended time.Time
+				if requests != nil {
+					var ok bool
+					if intended, ok = <-requests; !ok {
+						return
+					}
+				}
+				doc, ok := <-docs
+				if !ok {
+					outOfDocs.Do(func() {
+						log.Println(fmt.Sprintf("The writers ran out of documents to index after %s", time.Since(startTime).String()))
+					})
+					return
+				}
+				// without a fixed rate, the time spent reading the document is not part of the write latency
+				if requests == nil {
+					intended = time.Now()
+				}
+				if asyncIdx, ok := idx.(index.AsyncIndex); ok {
+					// the write completes once its bulk request does, rather than once it is buffered
+					err := asyncIdx.IndexAsync([]index.Document{doc}, opts, func(_ index.Document, err error) {
+						recordWrite(intended, err, instantMutex)
+					})
+					if err != nil {
+						recordWrite(intended, err, instantMutex)
+					}
+					continue
+				}
+				err := idx.Index([]index.Document{doc}, opts)
+				recordWrite(intended, err, instantMutex)
+			}
+		}()
+	}
+	return wg
+}
+
+// recordWrite records the latency of a write issued by the writers at intended, or counts its error
+func recordWrite(intended time.Time, err error, instantMutex *sync.Mutex) {
+	if err != nil {
+		if atomic.AddUint64(&totalWriteErrors, 1) == 1 {
+			log.Println(fmt.Sprintf("First error while indexing documents during the benchmark: %v", err))
+		}
+		return
+	}
+	instantMutex.Lock()
+	err = recordCommandLatency(COMMAND_INDEX, time.Since(intended).Microseconds())
+	instantMutex.Unlock()
+	if err != nil {
+		panic(err)
+	}
+}
+
+// requestScheduler sends the intended send time of each request to the workers, at a fixed global rate of maxRps
+// requests per second. The intended send times are computed from the start of the benchmark and not from the moment
+// the previous request was picked up, so a slow server does not lower the offered load.
+// The requests channel is closed once the end of the benchmark is reached, or ctx is done.
+func requestScheduler(ctx context.Context, maxRps int64, start, end time.Time, requests chan<- time.Time) {
+	defer close(requests)
+	for i := int64(0); ; i++ {
+		intended := start.Add(time.Duration(i * int64(time.Second) / maxRps))
+		if !intended.Before(end) {
+			return
+		}
+		if wait := time.Until(intended); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+		} else if !time.Now().Before(end) {
+			return
+		}
+		select {
+		case requests <- intended:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runRequest calls f once, and records its latency in the total histogram and in the histogram of the command f
+// performed. The error returned by f, if any, is returned and the latency of the failed request is not recorded.
+//
+// The latency is measured from the intended send time of the request, so that when running at a fixed rate the time a
+// request spent waiting for a busy worker is accounted for (correcting the coordinated omission). When the
+// uncorrected histogram is enabled, the latency measured from the moment the request was actually sent is recorded
+// there as well.
+func runRequest(f func() (string, error), instantMutex *sync.Mutex, intended time.Time) error {
+	tst := time.Now()
+	command, err := f()
+	if err != nil {
+		return err
+	}
+	end := time.Now()
+	took := end.Sub(tst)
+	latency := end.Sub(intended).Microseconds()
+	instantMutex.Lock()
+	err = totalHistogram.RecordValue(latency)
+	if err == nil {
+		err = intervalHistogram.RecordValue(latency)
+	}
+	if err == nil && uncorrectedHistogram != nil {
+		err = uncorrectedHistogram.RecordValue(took.Microseconds())
+	}
+	if err == nil {
+		err = recordCommandLatency(command, latency)
+	}
+	instantMutex.Unlock()
+	if err != nil {
+		panic(err)
+	}
+	// update the total requests performed and total time
+	atomic.AddUint64(&totalOps, 1)
+	atomic.AddUint64(&totalTime, uint64(took))
+	return nil
 }
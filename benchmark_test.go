@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMixedWeights(t *testing.T) {
+	weights, err := ParseMixedWeights("search=70,prefix=20,wildcard=10")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"search": 70, "prefix": 20, "wildcard": 10}, weights)
+
+	weights, err = ParseMixedWeights(" search = 70 , prefix=30")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"search": 70, "prefix": 30}, weights)
+
+	for _, spec := range []string{"", "search", "search=70=1", "search=0", "search=-1", "search=x", "search=70,search=10"} {
+		_, err = ParseMixedWeights(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestMixedBenchmark(t *testing.T) {
+	rand.Seed(1)
+	picks := map[string]int{}
+	benchmark := func(queryType string) func() (string, error) {
+		return func() (string, error) {
+			picks[queryType]++
+			return queryType, nil
+		}
+	}
+	f := MixedBenchmark(map[string]func() (string, error){
+		"search": benchmark("search"),
+		"prefix": benchmark("prefix"),
+	}, map[string]int64{"search": 3, "prefix": 1})
+
+	n := 10000
+	for i := 0; i < n; i++ {
+		_, err := f()
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, n, picks["search"]+picks["prefix"])
+	assert.InDelta(t, 0.75, float64(picks["search"])/float64(n), 0.02)
+}
+
+func TestRequestScheduler(t *testing.T) {
+	start := time.Now()
+	end := start.Add(200 * time.Millisecond)
+	requests := make(chan time.Time, 100)
+	requestScheduler(context.Background(), 50, start, end, requests)
+
+	intended := []time.Time{}
+	for r := range requests {
+		intended = append(intended, r)
+	}
+	assert.Len(t, intended, 10)
+	for i, r := range intended {
+		assert.Equal(t, start.Add(time.Duration(i)*20*time.Millisecond), r)
+	}
+	assert.False(t, time.Now().Before(intended[len(intended)-1]))
+}
+
+func TestRequestSchedulerCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	start := time.Now()
+	requests := make(chan time.Time)
+	go requestScheduler(ctx, 1, start, start.Add(time.Hour), requests)
+
+	assert.Equal(t, start, <-requests)
+	cancel()
+	select {
+	case _, ok := <-requests:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("the requests channel was not closed once the context was cancelled")
+	}
+}
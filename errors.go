@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/RediSearch/RediSearchBenchmark/index"
+)
+
+const (
+	ERROR_CLASS_TIMEOUT            = "timeout"
+	ERROR_CLASS_CONNECTION_REFUSED = "connectionRefused"
+	ERROR_CLASS_SERVER             = "server"
+	ERROR_CLASS_PARSE              = "parse"
+	ERROR_CLASS_OTHER              = "other"
+)
+
+// the total number of failed requests per error class. The map itself is never modified, only the counters it holds
+var errorCounters = map[string]*uint64{
+	ERROR_CLASS_TIMEOUT:            new(uint64),
+	ERROR_CLASS_CONNECTION_REFUSED: new(uint64),
+	ERROR_CLASS_SERVER:             new(uint64),
+	ERROR_CLASS_PARSE:              new(uint64),
+	ERROR_CLASS_OTHER:              new(uint64),
+}
+
+// classifyError returns the error class of an error returned by one of the benchmark functions
+func classifyError(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return ERROR_CLASS_TIMEOUT
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ERROR_CLASS_TIMEOUT
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ERROR_CLASS_CONNECTION_REFUSED
+	case errors.Is(err, index.ErrServer):
+		return ERROR_CLASS_SERVER
+	case errors.Is(err, index.ErrParse):
+		return ERROR_CLASS_PARSE
+	}
+	return ERROR_CLASS_OTHER
+}
+
+// recordError accounts a failed request in the total and per class error counters.
+// The first error of each class is logged, so that the cause of the failures can be looked into.
+// It returns an error once the number of failed requests exceeds errorBudget. A negative errorBudget means no limit.
+func recordError(err error, errorBudget int64) error {
+	class := classifyError(err)
+	if atomic.AddUint64(errorCounters[class], 1) == 1 {
+		log.Println(fmt.Sprintf("First %s error: %v", class, err))
+	}
+	failed := atomic.AddUint64(&totalErrors, 1)
+	if errorBudget >= 0 && failed > uint64(errorBudget) {
+		return fmt.Errorf("%d failed requests exceeded the error budget of %d. Last error: %v", failed, errorBudget, err)
+	}
+	return nil
+}
+
+func GetErrorTotals() map[string]uint64 {
+	totals := map[string]uint64{}
+	for class, counter := range errorCounters {
+		totals[class] = atomic.LoadUint64(counter)
+	}
+	return totals
+}
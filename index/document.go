@@ -1,6 +1,7 @@
 package index
 
 import (
+	"fmt"
 	"sort"
 )
 
@@ -12,6 +13,12 @@ type Document struct {
 	Properties map[string]interface{}
 }
 
+// GeoPoint is a location in degrees, the value of geo fields
+type GeoPoint struct {
+	Lon float64 `json:"lon"`
+	Lat float64 `json:"lat"`
+}
+
 // NewDocument creates a document with the specific id and score
 func NewDocument(id string, score float32) Document {
 	return Document{
@@ -27,6 +34,23 @@ func (d Document) Set(name string, value interface{}) Document {
 	return d
 }
 
+// EstimatedSize returns the approximate size in bytes of the document id and properties, as sent to the engines
+func (d Document) EstimatedSize() int {
+	size := len(d.Id)
+	for name, value := range d.Properties {
+		size += len(name)
+		switch v := value.(type) {
+		case string:
+			size += len(v)
+		case []byte:
+			size += len(v)
+		default:
+			size += len(fmt.Sprint(v))
+		}
+	}
+	return size
+}
+
 // DocumentList is used to sort documents by descending score
 type DocumentList []Document
 
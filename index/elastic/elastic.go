@@ -12,6 +12,7 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"context"
@@ -21,10 +22,18 @@ import (
 	elastic "github.com/elastic/go-elasticsearch/v8"
 )
 
+// errIndexClosed is returned when indexing into or flushing an index after Close
+var errIndexClosed = errors.New("index closed")
+
 // Index is an ElasticSearch index
 type Index struct {
-	conn         *elastic.Client
-	bi           esutil.BulkIndexer
+	conn     *elastic.Client
+	bi       esutil.BulkIndexer
+	biConfig esutil.BulkIndexerConfig
+	// the accumulated stats of the bulk indexers already closed
+	biStats esutil.BulkIndexerStats
+	// guards bi, which is replaced when flushed
+	biMutex      sync.RWMutex
 	md           *index.Metadata
 	name         string
 	typ          string
@@ -95,7 +104,7 @@ func NewIndex(addr, name, typ string, disableCache bool, md *index.Metadata, use
 	bulkIndexerFlushBytes := int(5e+6)
 	bulkIndexerNumCpus := indexerNumCPUs
 
-	bi, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+	biConfig := esutil.BulkIndexerConfig{
 		Index:         name,                             // The default index name
 		Client:        es,                               // The Elasticsearch client
 		NumWorkers:    bulkIndexerNumCpus,               // The number of worker goroutines
@@ -106,15 +115,17 @@ func NewIndex(addr, name, typ string, disableCache bool, md *index.Metadata, use
 		// if wait_for then wait for a refresh to make this operation visible to search,
 		// if false do nothing with refreshes. Valid values: true, false, wait_for. Default: false.
 		Refresh: bulkIndexerRefresh,
-	})
+	}
+	bi, err := esutil.NewBulkIndexer(biConfig)
 	if err != nil {
-		fmt.Println("Error creating the elastic indexer: %v", err)
+		fmt.Println(fmt.Sprintf("Error creating the elastic indexer: %v", err))
 		return nil, err
 	}
 
 	ret := &Index{
 		conn:         es,
 		bi:           bi,
+		biConfig:     biConfig,
 		md:           md,
 		name:         name,
 		typ:          typ,
@@ -140,6 +151,10 @@ func fieldTypeString(f index.FieldType) (string, error) {
 		return "text", nil
 	case index.NumericField:
 		return "double", nil
+	case index.ValueField:
+		return "keyword", nil
+	case index.GeoField:
+		return "geo_point", nil
 	default:
 		return "", errors.New("Unsupported field type")
 	}
@@ -149,8 +164,210 @@ func (i *Index) GetName() string {
 	return i.name
 }
 
+// DocumentCount flushes the pending bulk indexer items, refreshes the index and returns the number of documents
+// reported by the _count API, or -1 on error. A missing index has no documents, and a closed one has nothing to flush
 func (i *Index) DocumentCount() int64 {
-	return 0
+	if err := i.flushBulkIndexer(); err != nil && err != errIndexClosed {
+		log.Printf("Error flushing the bulk indexer: %v", err)
+		return -1
+	}
+	res, err := i.conn.Indices.Refresh(i.conn.Indices.Refresh.WithIndex(i.name), i.conn.Indices.Refresh.WithIgnoreUnavailable(true))
+	if err != nil {
+		log.Printf("Error refreshing the index: %v", err)
+		return -1
+	}
+	res.Body.Close()
+	if res.IsError() {
+		log.Printf("Error refreshing the index: %s", res.String())
+		return -1
+	}
+	res, err = i.conn.Count(i.conn.Count.WithIndex(i.name), i.conn.Count.WithIgnoreUnavailable(true))
+	if err != nil {
+		log.Printf("Error counting the documents: %v", err)
+		return -1
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		log.Printf("Error counting the documents: %s", res.String())
+		return -1
+	}
+	var r struct {
+		Count int64 `json:"count"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		log.Printf("Error parsing the count response: %v", err)
+		return -1
+	}
+	return r.Count
+}
+
+// flushBulkIndexer sends the items buffered by the bulk indexer and waits for them to be indexed. The bulk indexer
+// can only be flushed by closing it, so it is replaced by a new one with the same configuration
+func (i *Index) flushBulkIndexer() error {
+	i.biMutex.Lock()
+	defer i.biMutex.Unlock()
+	if i.bi == nil {
+		return errIndexClosed
+	}
+	if err := i.closeBulkIndexer(); err != nil {
+		return err
+	}
+	bi, err := esutil.NewBulkIndexer(i.biConfig)
+	if err != nil {
+		return err
+	}
+	i.bi = bi
+	return nil
+}
+
+// closeBulkIndexer closes the bulk indexer and accumulates its stats, unless it is already closed.
+// The caller must hold biMutex
+func (i *Index) closeBulkIndexer() error {
+	if i.bi == nil {
+		return nil
+	}
+	err := i.bi.Close(context.Background())
+	i.biStats = addBulkIndexerStats(i.biStats, i.bi.Stats())
+	return err
+}
+
+// BulkIndexerStats returns the stats of all the documents added to the bulk indexer since the index was created
+func (i *Index) BulkIndexerStats() esutil.BulkIndexerStats {
+	i.biMutex.RLock()
+	defer i.biMutex.RUnlock()
+	if i.bi == nil {
+		return i.biStats
+	}
+	return addBulkIndexerStats(i.biStats, i.bi.Stats())
+}
+
+// IndexingStats returns the bulk indexer stats
+func (i *Index) IndexingStats() map[string]interface{} {
+	return map[string]interface{}{"bulkIndexer": i.BulkIndexerStats()}
+}
+
+func addBulkIndexerStats(a, b esutil.BulkIndexerStats) esutil.BulkIndexerStats {
+	return esutil.BulkIndexerStats{
+		NumAdded:    a.NumAdded + b.NumAdded,
+		NumFlushed:  a.NumFlushed + b.NumFlushed,
+		NumFailed:   a.NumFailed + b.NumFailed,
+		NumIndexed:  a.NumIndexed + b.NumIndexed,
+		NumCreated:  a.NumCreated + b.NumCreated,
+		NumUpdated:  a.NumUpdated + b.NumUpdated,
+		NumDeleted:  a.NumDeleted + b.NumDeleted,
+		NumRequests: a.NumRequests + b.NumRequests,
+	}
+}
+
+// Flush sends the documents buffered by the bulk indexer and waits for them to be indexed.
+// It fails if any document added to the bulk indexer failed to be indexed
+func (i *Index) Flush() error {
+	if err := i.flushBulkIndexer(); err != nil {
+		return err
+	}
+	return i.checkBulkIndexerFailures()
+}
+
+// Close flushes and closes the bulk indexer.
+// It fails if any document added to the bulk indexer failed to be indexed. Closing it again has no effect, while
+// indexing or flushing a closed index fails
+func (i *Index) Close() error {
+	i.biMutex.Lock()
+	err := i.closeBulkIndexer()
+	i.bi = nil
+	i.biMutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return i.checkBulkIndexerFailures()
+}
+
+func (i *Index) checkBulkIndexerFailures() error {
+	if failed := i.BulkIndexerStats().NumFailed; failed > 0 {
+		return fmt.Errorf("%w: %d documents failed to be bulk indexed", index.ErrServer, failed)
+	}
+	return nil
+}
+
+// IndexSize returns the store size of the primary shards of the index
+func (i *Index) IndexSize() (int64, error) {
+	res, err := i.conn.Indices.Stats(i.conn.Indices.Stats.WithIndex(i.name), i.conn.Indices.Stats.WithMetric("store"))
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return 0, fmt.Errorf("%w: %s", index.ErrServer, res.String())
+	}
+	var r struct {
+		Indices map[string]struct {
+			Primaries struct {
+				Store struct {
+					SizeInBytes int64 `json:"size_in_bytes"`
+				} `json:"store"`
+			} `json:"primaries"`
+		} `json:"indices"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return 0, fmt.Errorf("%w: error parsing the index stats: %v", index.ErrParse, err)
+	}
+	return r.Indices[i.name].Primaries.Store.SizeInBytes, nil
+}
+
+// the normalizer of the case-insensitive value fields
+const lowercaseNormalizer = "lowercase_normalizer"
+
+// the subfield of the text fields with stemming, analyzed by the english analyzer
+const stemmedSubfield = "stemmed"
+
+// textFieldMapping returns the mapping parameters of a text field. The field itself is analyzed by the standard
+// analyzer, so the prefix, suffix, wildcard and contains queries match the original terms, while the full-text queries
+// of stemmed fields run on a subfield analyzed by the english analyzer, like RediSearch indexes both the term and its
+// stem. Text fields can't be sorted on, so sortable fields get a keyword subfield with doc values.
+// The weight isn't part of the mapping, as index time boosts are not supported, and is applied as a query boost
+func textFieldMapping(opts index.TextFieldOptions) mappingProperty {
+	m := mappingProperty{"analyzer": "standard"}
+	fields := map[string]interface{}{}
+	if opts.Stemming {
+		fields[stemmedSubfield] = map[string]interface{}{
+			"type":     "text",
+			"analyzer": "english",
+		}
+	}
+	if opts.Sortable {
+		fields["keyword"] = map[string]interface{}{
+			"type":       "keyword",
+			"doc_values": true,
+			// longer values are not indexed in the subfield, as terms are limited to 32766 bytes, and up to 4
+			// bytes per character
+			"ignore_above": 8191,
+		}
+	}
+	if len(fields) > 0 {
+		m["fields"] = fields
+	}
+	return m
+}
+
+// matchField returns the field the full-text queries on name run on, which is the stemmed subfield of text fields
+// with stemming
+func (i *Index) matchField(name string) string {
+	for _, f := range i.md.Fields {
+		if opts, ok := f.Options.(index.TextFieldOptions); ok && f.Name == name && opts.Stemming {
+			return name + "." + stemmedSubfield
+		}
+	}
+	return name
+}
+
+// fieldBoost returns the query boost of a field, which is its weight for text fields and 1 otherwise
+func (i *Index) fieldBoost(name string) float32 {
+	for _, f := range i.md.Fields {
+		if opts, ok := f.Options.(index.TextFieldOptions); ok && f.Name == name && opts.Weight > 0 {
+			return opts.Weight
+		}
+	}
+	return 1
 }
 
 // Create creates the index and posts a mapping corresponding to our Metadata
@@ -163,6 +380,24 @@ func (i *Index) Create() error {
 			return err
 		}
 		mappings.Properties[f.Name]["type"] = fs
+		if f.Type == index.TextField {
+			opts, ok := f.Options.(index.TextFieldOptions)
+			if !ok {
+				return errors.New("Invalid text field options type")
+			}
+			for k, v := range textFieldMapping(opts) {
+				mappings.Properties[f.Name][k] = v
+			}
+		}
+		if f.Type == index.ValueField {
+			opts, ok := f.Options.(index.ValueFieldOptions)
+			if !ok {
+				return errors.New("Invalid value field options type")
+			}
+			if !opts.CaseSensitive {
+				mappings.Properties[f.Name]["normalizer"] = lowercaseNormalizer
+			}
+		}
 	}
 
 	settings := map[string]interface{}{
@@ -171,6 +406,14 @@ func (i *Index) Create() error {
 			"number_of_replicas":    i.replicaCount,
 			"requests.cache.enable": !i.disableCache,
 		},
+		"analysis": map[string]interface{}{
+			"normalizer": map[string]interface{}{
+				lowercaseNormalizer: map[string]interface{}{
+					"type":   "custom",
+					"filter": []string{"lowercase"},
+				},
+			},
+		},
 	}
 	fmt.Println("Ensuring that if the index exists we recreat it")
 	// Re-create the index
@@ -198,11 +441,127 @@ func (i *Index) Create() error {
 	return err
 }
 
+// documentSource returns the properties of a document to be indexed, with the values of the value fields split by
+// their separator into arrays, as keyword fields hold multiple values as arrays
+func (i *Index) documentSource(doc index.Document) map[string]interface{} {
+	var source map[string]interface{}
+	for _, f := range i.md.Fields {
+		opts, ok := f.Options.(index.ValueFieldOptions)
+		if !ok || f.Type != index.ValueField || opts.Separator == "" {
+			continue
+		}
+		value, ok := doc.Properties[f.Name].(string)
+		if !ok || !strings.Contains(value, opts.Separator) {
+			continue
+		}
+		// copy the properties, as the document may be indexed again
+		if source == nil {
+			source = make(map[string]interface{}, len(doc.Properties))
+			for k, v := range doc.Properties {
+				source[k] = v
+			}
+		}
+		values := strings.Split(value, opts.Separator)
+		for j := range values {
+			values[j] = strings.TrimSpace(values[j])
+		}
+		source[f.Name] = values
+	}
+	if source == nil {
+		return doc.Properties
+	}
+	return source
+}
+
+// withFilters wraps a query clause in a bool query, filtering the matches with the query predicates
+func (i *Index) withFilters(q query.Query, clause map[string]interface{}) (map[string]interface{}, error) {
+	if len(q.Predicates) == 0 {
+		return clause, nil
+	}
+	filters := make([]interface{}, 0, len(q.Predicates))
+	for _, p := range q.Predicates {
+		filter, err := i.predicateFilter(p)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must":   clause,
+			"filter": filters,
+		},
+	}, nil
+}
+
+// predicateFilter translates a predicate to a filter clause, according to the type of the field it applies to
+func (i *Index) predicateFilter(p query.Predicate) (map[string]interface{}, error) {
+	var field *index.Field
+	for j := range i.md.Fields {
+		if i.md.Fields[j].Name == p.Property {
+			field = &i.md.Fields[j]
+		}
+	}
+	if field == nil {
+		return nil, fmt.Errorf("predicate on unknown field %s", p.Property)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	switch {
+	case field.Type == index.ValueField && p.Operator == query.Eq:
+		return map[string]interface{}{"term": map[string]interface{}{p.Property: p.Value[0]}}, nil
+	case field.Type == index.ValueField && p.Operator == query.In:
+		return map[string]interface{}{"terms": map[string]interface{}{p.Property: p.Value}}, nil
+	case field.Type == index.NumericField:
+		min, max, minInclusive, maxInclusive, err := p.Range()
+		if err != nil {
+			return nil, err
+		}
+		bounds := map[string]interface{}{}
+		if min != nil {
+			if minInclusive {
+				bounds["gte"] = min
+			} else {
+				bounds["gt"] = min
+			}
+		}
+		if max != nil {
+			if maxInclusive {
+				bounds["lte"] = max
+			} else {
+				bounds["lt"] = max
+			}
+		}
+		return map[string]interface{}{"range": map[string]interface{}{p.Property: bounds}}, nil
+	case field.Type == index.GeoField && p.Operator == query.GeoRadius:
+		return map[string]interface{}{
+			"geo_distance": map[string]interface{}{
+				"distance": fmt.Sprintf("%vkm", p.Value[2]),
+				p.Property: map[string]interface{}{"lon": p.Value[0], "lat": p.Value[1]},
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported predicate %s on field %s", p.Operator, p.Property)
+}
+
 // Index indexes multiple documents
 func (i *Index) Index(docs []index.Document, opts interface{}) error {
+	return i.IndexAsync(docs, opts, nil)
+}
+
+// IndexAsync adds the documents to the bulk indexer, and calls done for each of them once its bulk request completed.
+// done is called from the bulk indexer workers, and can be nil
+func (i *Index) IndexAsync(docs []index.Document, opts interface{}, done func(doc index.Document, err error)) error {
 	var err error
+	i.biMutex.RLock()
+	defer i.biMutex.RUnlock()
+	if i.bi == nil {
+		return errIndexClosed
+	}
 	for _, doc := range docs {
-		data, err := json.Marshal(doc.Properties)
+		doc := doc
+		data, err := json.Marshal(i.documentSource(doc))
 		if err != nil {
 			return err
 		}
@@ -221,19 +580,26 @@ func (i *Index) Index(docs []index.Document, opts interface{}) error {
 
 				// OnSuccess is called for each successful operation
 				OnSuccess: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem) {
+					if done != nil {
+						done(doc, nil)
+					}
 				},
 				// OnFailure is called for each failed operation
 				OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
 					if err != nil {
-						fmt.Printf("ERROR BULK INSERT: %s", err)
+						log.Printf("Failed to bulk index document %s: %v", item.DocumentID, err)
 					} else {
-						fmt.Printf("ERROR BULK INSERT: %s: %s", res.Error.Type, res.Error.Reason)
+						log.Printf("Failed to bulk index document %s: %s: %s", item.DocumentID, res.Error.Type, res.Error.Reason)
+						err = fmt.Errorf("%w: %s: %s", index.ErrServer, res.Error.Type, res.Error.Reason)
+					}
+					if done != nil {
+						done(doc, err)
 					}
 				},
 			},
 		)
 		if err != nil {
-			fmt.Println("Unexpected error while bulk inserting: %s", err)
+			fmt.Println(fmt.Sprintf("Unexpected error while bulk inserting: %s", err))
 			return err
 		}
 	}
@@ -250,10 +616,16 @@ func (i *Index) PrefixQuery(q query.Query, verbose int) ([]index.Document, int,
 			"prefix": map[string]interface{}{
 				q.Field: map[string]interface{}{
 					"value": q.Term,
+					"boost": i.fieldBoost(q.Field),
 				},
 			},
 		},
 	}
+	filtered, err := i.withFilters(q, query["query"].(map[string]interface{}))
+	if err != nil {
+		return nil, 0, err
+	}
+	query["query"] = filtered
 	hits, err := elasticSearchQuery(i.name, es, verbose, query)
 	return nil, hits, err
 }
@@ -262,7 +634,7 @@ func elasticSearchQuery(indexName string, es *elastic.Client, verbose int, query
 	// Build the request body.
 	var buf bytes.Buffer
 	if err := json.NewEncoder(&buf).Encode(query); err != nil {
-		log.Fatalf("Error encoding query: %s", err)
+		return 0, fmt.Errorf("error encoding query: %w", err)
 	}
 	var r map[string]interface{}
 
@@ -273,32 +645,35 @@ func elasticSearchQuery(indexName string, es *elastic.Client, verbose int, query
 		es.Search.WithBody(&buf),
 		es.Search.WithTrackTotalHits(true))
 	if err != nil {
-		log.Fatalf("Error getting response: %s", err)
+		return 0, err
 	}
 	defer res.Body.Close()
-	hits := elasticParseResponse(r, verbose, res, query)
-	return hits, err
+	return elasticParseResponse(r, verbose, res, query)
 }
 
-func elasticParseResponse(r map[string]interface{}, verbose int, res *esapi.Response, query map[string]interface{}) int {
+func elasticParseResponse(r map[string]interface{}, verbose int, res *esapi.Response, query map[string]interface{}) (int, error) {
 	if res.IsError() {
 		var e map[string]interface{}
 		if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
-			log.Fatalf("Error parsing the response body: %s", err)
-		} else {
-			// Print the response status and error information.
-			log.Fatalf("[%s] %s: %s",
-				res.Status(),
-				e["error"].(map[string]interface{})["type"],
-				e["error"].(map[string]interface{})["reason"],
-			)
+			return 0, fmt.Errorf("%w: [%s] %v", index.ErrServer, res.Status(), err)
+		}
+		// Return the response status and error information.
+		if errorInfo, ok := e["error"].(map[string]interface{}); ok {
+			return 0, fmt.Errorf("%w: [%s] %v: %v", index.ErrServer, res.Status(), errorInfo["type"], errorInfo["reason"])
 		}
+		return 0, fmt.Errorf("%w: [%s] %v", index.ErrServer, res.Status(), e)
 	}
 	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-		log.Fatalf("Error parsing the response body: %s", err)
+		return 0, fmt.Errorf("%w: error parsing the response body: %v", index.ErrParse, err)
 	}
 	// Print the response status, number of results, and request duration.
-	hits := int(r["hits"].(map[string]interface{})["total"].(map[string]interface{})["value"].(float64))
+	hitsInfo, _ := r["hits"].(map[string]interface{})
+	totalInfo, _ := hitsInfo["total"].(map[string]interface{})
+	totalHits, ok := totalInfo["value"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("%w: missing hits.total.value in response %v", index.ErrParse, r)
+	}
+	hits := int(totalHits)
 	if verbose > 1 {
 		log.Printf(
 			"query %v. [%s] %d hits; took: %dms",
@@ -307,7 +682,7 @@ func elasticParseResponse(r map[string]interface{}, verbose int, res *esapi.Resp
 			int(r["took"].(float64)),
 		)
 	}
-	return hits
+	return hits, nil
 }
 
 // https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-wildcard-query.html
@@ -320,10 +695,16 @@ func (i *Index) ContainsQuery(q query.Query, verbose int) ([]index.Document, int
 			"wildcard": map[string]interface{}{
 				q.Field: map[string]interface{}{
 					"value": q.Term,
+					"boost": i.fieldBoost(q.Field),
 				},
 			},
 		},
 	}
+	filtered, err := i.withFilters(q, query["query"].(map[string]interface{}))
+	if err != nil {
+		return nil, 0, err
+	}
+	query["query"] = filtered
 	hits, err := elasticSearchQuery(i.name, es, verbose, query)
 	return nil, hits, err
 }
@@ -338,10 +719,16 @@ func (i *Index) SuffixQuery(q query.Query, verbose int) ([]index.Document, int,
 			"wildcard": map[string]interface{}{
 				q.Field: map[string]interface{}{
 					"value": q.Term,
+					"boost": i.fieldBoost(q.Field),
 				},
 			},
 		},
 	}
+	filtered, err := i.withFilters(q, query["query"].(map[string]interface{}))
+	if err != nil {
+		return nil, 0, err
+	}
+	query["query"] = filtered
 	hits, err := elasticSearchQuery(i.name, es, verbose, query)
 	return nil, hits, err
 }
@@ -356,10 +743,16 @@ func (i *Index) WildCardQuery(q query.Query, verbose int) ([]index.Document, int
 			"wildcard": map[string]interface{}{
 				q.Field: map[string]interface{}{
 					"value": q.Term,
+					"boost": i.fieldBoost(q.Field),
 				},
 			},
 		},
 	}
+	filtered, err := i.withFilters(q, query["query"].(map[string]interface{}))
+	if err != nil {
+		return nil, 0, err
+	}
+	query["query"] = filtered
 	hits, err := elasticSearchQuery(i.name, es, verbose, query)
 	return nil, hits, err
 }
@@ -374,13 +767,25 @@ func (i *Index) FullTextQuerySingleField(q query.Query, verbose int) ([]index.Do
 		"size": q.Paging.Num,
 		"query": map[string]interface{}{
 			"match": map[string]interface{}{
-				q.Field: q.Term,
+				i.matchField(q.Field): map[string]interface{}{
+					"query": q.Term,
+					"boost": i.fieldBoost(q.Field),
+				},
 			},
 		},
 	}
+	// a query without term only filters on its predicates
+	if q.Term == "" {
+		query["query"] = map[string]interface{}{"match_all": map[string]interface{}{}}
+	}
 
 	es := i.conn
 
+	filtered, err := i.withFilters(q, query["query"].(map[string]interface{}))
+	if err != nil {
+		return nil, 0, err
+	}
+	query["query"] = filtered
 	hits, err := elasticSearchQuery(i.name, es, verbose, query)
 	return nil, hits, err
 }
@@ -1,8 +1,11 @@
+//go:build integration
+
+// These tests need an elasticsearch server on localhost:9200, and are only built with the integration tag
+
 package elastic
 
 import (
 	"fmt"
-	"strings"
 	"testing"
 
 	"github.com/RediSearch/RediSearchBenchmark/index"
@@ -16,8 +19,9 @@ func TestIndex(t *testing.T) {
 	md := index.NewMetadata().AddField(index.NewTextField("title", 1.0)).
 		AddField(index.NewNumericField("score"))
 
-	idx, err := NewIndex("http://localhost:9200", "testung", "doc", false, md, "elastic", "", 1, 1, 1, true)
+	idx, err := NewIndex("http://localhost:9200", "testung", "doc", false, md, "elastic", "", 1, 1, 1, true, 1, "true")
 	assert.NoError(t, err)
+	defer idx.Close()
 	assert.NoError(t, idx.Drop())
 	assert.NoError(t, idx.Create())
 
@@ -32,38 +36,13 @@ func TestIndex(t *testing.T) {
 	//	assert.NoError(t, idx.Create())
 
 	assert.NoError(t, idx.Index(docs, nil))
+	assert.Equal(t, int64(100), idx.DocumentCount())
 
 	q := query.NewQuery("doc", "hello world")
-	docs, total, err := idx.FullTextQuerySingleField(*q, 0)
+	_, total, err := idx.FullTextQuerySingleField(*q, 0)
 
-	t.Log(docs, total, err)
+	t.Log(total, err)
 	assert.NoError(t, err)
 	assert.True(t, total == 100)
-	assert.Len(t, docs, 10)
-	assert.True(t, strings.HasPrefix(docs[0].Id, "doc"))
-	assert.Equal(t, docs[0].Properties["title"], "hello world")
-
-}
-
-func TestSuggest(t *testing.T) {
 
-	md := index.NewMetadata().AddField(index.NewTextField("title", 1.0)).
-		AddField(index.NewNumericField("score"))
-
-	idx, err := NewIndex("http://localhost:9200", "testung", "doc", false, md, "elastic", "", 1, 1, 1, true)
-	assert.NoError(t, err)
-	assert.NoError(t, idx.Drop())
-	assert.NoError(t, idx.Create())
-
-	suggs := []index.Suggestion{}
-	for i := 0; i < 100; i++ {
-		suggs = append(suggs, index.Suggestion{fmt.Sprintf("suggestion %d", i), float64(i)})
-	}
-
-	assert.NoError(t, idx.AddTerms(suggs...))
-
-	suggs, err = idx.Suggest("sugg", 10, false)
-	assert.NoError(t, err)
-	fmt.Println(suggs)
-	assert.True(t, len(suggs) == 10)
 }
@@ -0,0 +1,106 @@
+package elastic
+
+import (
+	"testing"
+
+	"github.com/RediSearch/RediSearchBenchmark/index"
+	"github.com/RediSearch/RediSearchBenchmark/query"
+	"github.com/stretchr/testify/assert"
+)
+
+type m = map[string]interface{}
+
+func TestPredicateFilter(t *testing.T) {
+	md := index.NewMetadata().
+		AddField(index.NewNumericField("ts")).
+		AddField(index.NewValueField("sub")).
+		AddField(index.NewGeoField("location")).
+		AddField(index.NewTextField("body", 1))
+	idx := &Index{md: md}
+
+	tests := []struct {
+		name      string
+		predicate query.Predicate
+		want      map[string]interface{}
+	}{
+		{"equals", query.Equals("ts", 10), m{"range": m{"ts": m{"gte": 10, "lte": 10}}}},
+		{"greater than", query.GreaterThan("ts", 10), m{"range": m{"ts": m{"gt": 10}}}},
+		{"greater than equals", query.GreaterThanEquals("ts", 10), m{"range": m{"ts": m{"gte": 10}}}},
+		{"less than", query.LessThan("ts", 20), m{"range": m{"ts": m{"lt": 20}}}},
+		{"less than equals", query.LessThanEquals("ts", 20), m{"range": m{"ts": m{"lte": 20}}}},
+		{"inclusive range", query.InRange("ts", 10, 20, true), m{"range": m{"ts": m{"gte": 10, "lte": 20}}}},
+		{"exclusive range", query.InRange("ts", 10, 20, false), m{"range": m{"ts": m{"gt": 10, "lt": 20}}}},
+		{"min inclusive range", query.NewRange("ts", 10, 20, true, false), m{"range": m{"ts": m{"gte": 10, "lt": 20}}}},
+		{"max inclusive range", query.NewRange("ts", 10, 20, false, true), m{"range": m{"ts": m{"gt": 10, "lte": 20}}}},
+		{"tag equals", query.Equals("sub", "golang"), m{"term": m{"sub": "golang"}}},
+		{"tag in", query.IsIn("sub", "golang", "new york"), m{"terms": m{"sub": []interface{}{"golang", "new york"}}}},
+		{"geo radius", query.WithinRadius("location", 2.35, 48.85, 10.0), m{"geo_distance": m{"distance": "10km", "location": m{"lon": 2.35, "lat": 48.85}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := idx.predicateFilter(tt.predicate)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	invalid := []query.Predicate{
+		query.NewRange("ts", 20, 10, true, true),
+		query.GreaterThan("ts", "10"),
+		query.Equals("missing", 10),
+		query.GreaterThan("body", 10),
+	}
+	for _, p := range invalid {
+		_, err := idx.predicateFilter(p)
+		assert.Error(t, err, "predicate %v", p)
+	}
+}
+
+func TestWithFilters(t *testing.T) {
+	md := index.NewMetadata().
+		AddField(index.NewNumericField("ts")).
+		AddField(index.NewTextField("body", 1))
+	idx := &Index{md: md}
+	match := m{"match": m{"body": m{"query": "hello"}}}
+
+	got, err := idx.withFilters(*query.NewQuery("idx", "hello"), match)
+	assert.NoError(t, err)
+	assert.Equal(t, match, got)
+
+	q := query.NewQuery("idx", "hello").AddPredicate(query.GreaterThan("ts", 10)).AddPredicate(query.LessThanEquals("ts", 20))
+	got, err = idx.withFilters(*q, match)
+	assert.NoError(t, err)
+	assert.Equal(t, m{"bool": m{
+		"must": match,
+		"filter": []interface{}{
+			m{"range": m{"ts": m{"gt": 10}}},
+			m{"range": m{"ts": m{"lte": 20}}},
+		},
+	}}, got)
+
+	_, err = idx.withFilters(*query.NewQuery("idx", "hello").AddPredicate(query.InRange("missing", 10, 20, true)), match)
+	assert.Error(t, err)
+}
+
+func TestTextFieldMapping(t *testing.T) {
+	stemmed := m{"type": "text", "analyzer": "english"}
+	keyword := m{"type": "keyword", "doc_values": true, "ignore_above": 8191}
+
+	assert.Equal(t, mappingProperty{"analyzer": "standard"}, textFieldMapping(index.TextFieldOptions{}))
+	assert.Equal(t, mappingProperty{"analyzer": "standard", "fields": m{"stemmed": stemmed}},
+		textFieldMapping(index.TextFieldOptions{Stemming: true}))
+	assert.Equal(t, mappingProperty{"analyzer": "standard", "fields": m{"stemmed": stemmed, "keyword": keyword}},
+		textFieldMapping(index.TextFieldOptions{Stemming: true, Sortable: true}))
+}
+
+func TestMatchField(t *testing.T) {
+	md := index.NewMetadata().
+		AddField(index.NewTextField("body", 1)).
+		AddField(index.Field{Name: "title", Type: index.TextField, Options: index.TextFieldOptions{Weight: 1}}).
+		AddField(index.NewNumericField("ts"))
+	idx := &Index{md: md}
+
+	assert.Equal(t, "body.stemmed", idx.matchField("body"))
+	assert.Equal(t, "title", idx.matchField("title"))
+	assert.Equal(t, "ts", idx.matchField("ts"))
+}
@@ -0,0 +1,41 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrServer is wrapped by the errors returned when the search engine replied with an error
+	ErrServer = errors.New("server error")
+
+	// ErrParse is wrapped by the errors returned when a reply of the search engine could not be parsed
+	ErrParse = errors.New("parse error")
+)
+
+// DocumentError is the error of a single document that failed to be indexed
+type DocumentError struct {
+	Id  string
+	Err error
+}
+
+// IndexingError is returned when some of the documents passed to Index failed to be indexed, while the others were
+// indexed
+type IndexingError struct {
+	Failed []DocumentError
+}
+
+func (e *IndexingError) Error() string {
+	if len(e.Failed) == 0 {
+		return "no documents failed to be indexed"
+	}
+	return fmt.Sprintf("%d documents failed to be indexed, first failure on document %s: %v", len(e.Failed), e.Failed[0].Id, e.Failed[0].Err)
+}
+
+// Unwrap returns the error of the first failed document
+func (e *IndexingError) Unwrap() error {
+	if len(e.Failed) == 0 {
+		return nil
+	}
+	return e.Failed[0].Err
+}
@@ -16,5 +16,28 @@ type Index interface {
 	ContainsQuery(q query.Query, debug int) (docs []Document, total int, err error)
 	Drop() error
 	DocumentCount() int64
+	// IndexSize returns the size of the index in bytes
+	IndexSize() (int64, error)
 	Create() error
+	// Flush sends the documents buffered by Index and waits for them to be indexed
+	Flush() error
+	// Close flushes the index and releases its connections
+	Close() error
+}
+
+// AsyncIndex is implemented by the indexes whose Index only buffers the documents, which are written later in the
+// background, like the elasticsearch bulk indexer
+type AsyncIndex interface {
+	Index
+	// IndexAsync buffers the documents like Index, and calls done for each of them once it was written or failed to
+	// be. done may be called from other go-routines, and only after the documents are flushed
+	IndexAsync(documents []Document, options interface{}, done func(doc Document, err error)) error
+}
+
+// StatsIndex is implemented by the indexes that keep engine specific indexing stats, like the elasticsearch bulk
+// indexer stats, which are stored along with the ingestion results
+type StatsIndex interface {
+	Index
+	// IndexingStats returns the indexing stats by name
+	IndexingStats() map[string]interface{}
 }
@@ -66,6 +66,32 @@ func NewNumericField(name string) Field {
 	}
 }
 
+// NewGeoField creates a new geo field with the given name, holding GeoPoint values
+func NewGeoField(name string) Field {
+	return Field{
+		Name: name,
+		Type: GeoField,
+	}
+}
+
+// ValueFieldOptions Options for value fields - the separator splitting multiple values, and whether the values
+// are matched case-sensitively.
+type ValueFieldOptions struct {
+	Separator     string
+	CaseSensitive bool
+}
+
+// NewValueField creates a new case-insensitive value field with the given name, holding comma separated values
+func NewValueField(name string) Field {
+	return Field{
+		Name: name,
+		Type: ValueField,
+		Options: ValueFieldOptions{
+			Separator: ",",
+		},
+	}
+}
+
 // Metadata represents an index schema metadata, or how the index would
 // treat documents sent to it.
 type Metadata struct {
@@ -0,0 +1,83 @@
+package redisearch
+
+import (
+	"testing"
+
+	"github.com/RediSearch/RediSearchBenchmark/index"
+	"github.com/RediSearch/RediSearchBenchmark/query"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPredicateFilter(t *testing.T) {
+	md := index.NewMetadata().
+		AddField(index.NewNumericField("ts")).
+		AddField(index.NewValueField("sub")).
+		AddField(index.NewGeoField("location")).
+		AddField(index.NewTextField("body", 1))
+	idx := &Index{md: md}
+
+	tests := []struct {
+		name      string
+		predicate query.Predicate
+		want      string
+	}{
+		{"equals", query.Equals("ts", 10), "@ts:[10 10]"},
+		{"greater than", query.GreaterThan("ts", 10), "@ts:[(10 +inf]"},
+		{"greater than equals", query.GreaterThanEquals("ts", 10), "@ts:[10 +inf]"},
+		{"less than", query.LessThan("ts", 20), "@ts:[-inf (20]"},
+		{"less than equals", query.LessThanEquals("ts", 20), "@ts:[-inf 20]"},
+		{"inclusive range", query.InRange("ts", 10, 20, true), "@ts:[10 20]"},
+		{"exclusive range", query.InRange("ts", 10, 20, false), "@ts:[(10 (20]"},
+		{"min inclusive range", query.NewRange("ts", 10, 20, true, false), "@ts:[10 (20]"},
+		{"max inclusive range", query.NewRange("ts", 10, 20, false, true), "@ts:[(10 20]"},
+		{"tag equals", query.Equals("sub", "golang"), "@sub:{golang}"},
+		{"tag in", query.IsIn("sub", "golang", "new york"), "@sub:{golang | new\\ york}"},
+		{"geo radius", query.WithinRadius("location", 2.35, 48.85, 10.0), "@location:[2.35 48.85 10 km]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := idx.predicateFilter(tt.predicate)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	invalid := []query.Predicate{
+		query.NewRange("ts", 20, 10, true, true),
+		query.GreaterThan("ts", "10"),
+		query.Equals("missing", 10),
+		query.GreaterThan("body", 10),
+	}
+	for _, p := range invalid {
+		_, err := idx.predicateFilter(p)
+		assert.Error(t, err, "predicate %v", p)
+	}
+}
+
+func TestSearchQuery(t *testing.T) {
+	md := index.NewMetadata().
+		AddField(index.NewNumericField("ts")).
+		AddField(index.NewTextField("body", 1))
+	idx := &Index{md: md}
+
+	tests := []struct {
+		name  string
+		query *query.Query
+		want  string
+	}{
+		{"term", query.NewQuery("idx", "hello").SetField("body"), "@body:hello"},
+		{"term and range", query.NewQuery("idx", "hello").SetField("body").AddPredicate(query.InRange("ts", 10, 20, true)), "@body:hello @ts:[10 20]"},
+		{"term and bounds", query.NewQuery("idx", "hello").SetField("body").AddPredicate(query.GreaterThan("ts", 10)).AddPredicate(query.LessThanEquals("ts", 20)), "@body:hello @ts:[(10 +inf] @ts:[-inf 20]"},
+		{"range only", query.NewQuery("idx", "").AddPredicate(query.InRange("ts", 10, 20, false)), "@ts:[(10 (20]"},
+		{"match all", query.NewQuery("idx", ""), "*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := idx.searchQuery(*tt.query)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	_, err := idx.searchQuery(*query.NewQuery("idx", "hello").AddPredicate(query.InRange("missing", 10, 20, true)))
+	assert.Error(t, err)
+}
@@ -2,12 +2,14 @@ package redisearch
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/RediSearch/RediSearchBenchmark/index"
 	"github.com/RediSearch/RediSearchBenchmark/query"
@@ -34,12 +36,10 @@ type IndexingOptions struct {
 	Prefix string
 }
 
-var total int64 = 0
-var mu sync.Mutex = sync.Mutex{}
-
 type redisClient interface {
 	Do(ctx context.Context, args ...interface{}) *goredis.Cmd
 	FlushDB(ctx context.Context) *goredis.StatusCmd
+	Pipeline() goredis.Pipeliner
 	Close() error
 }
 
@@ -57,10 +57,21 @@ type Index struct {
 	standaloneClient *goredis.Client
 	cluster          bool
 	withSuffixTrie   bool
+	pipelineDepth    int
+	flushDB          bool
+	keyPrefix        string
+	storage          string
 }
 
-// NewIndex creates a new index connecting to the redis host, and using the given name as key prefix
-func NewIndex(addrs []string, pass string, temporary int, name string, md *index.Metadata, mode string, withSuffixTrie bool) *Index {
+// NewIndex creates a new index connecting to the redis host, and using the given name as key prefix.
+// Documents are indexed in pipelines of up to pipelineDepth commands. If flushDB is set Drop flushes the whole
+// database instead of dropping only the index. If keyPrefix is set it is prepended to the document keys, and the
+// index only covers the keys with that prefix. storage is either "hash" or "json", the latter storing the documents
+// with RedisJSON.
+func NewIndex(addrs []string, pass string, temporary int, name string, md *index.Metadata, mode string, withSuffixTrie bool, pipelineDepth int, flushDB bool, keyPrefix string, storage string) *Index {
+	if pipelineDepth < 1 {
+		pipelineDepth = 1
+	}
 	ret := &Index{
 		hosts:          addrs,
 		md:             md,
@@ -70,6 +81,10 @@ func NewIndex(addrs []string, pass string, temporary int, name string, md *index
 		commandPrefix:  "FT",
 		cluster:        false,
 		withSuffixTrie: withSuffixTrie,
+		pipelineDepth:  pipelineDepth,
+		flushDB:        flushDB,
+		keyPrefix:      keyPrefix,
+		storage:        storage,
 	}
 	switch mode {
 	case "cluster":
@@ -106,32 +121,92 @@ func NewIndex(addrs []string, pass string, temporary int, name string, md *index
 
 }
 
-func (i *Index) DocumentCount() (count int64) {
-	ctx := context.Background()
-	if i.cluster {
-		i.clientClient.ForEachMaster(ctx, docCountShard)
-	} else {
-		docCountShard(ctx, i.standaloneClient)
+// DocumentCount returns the number of documents in the index, as reported by FT.INFO num_docs, or -1 on error.
+// An index that doesn't exist has no documents.
+// In cluster mode FT.INFO is sent once, like FT.CREATE, and the coordinator replies the index-wide count
+func (i *Index) DocumentCount() int64 {
+	info, err := i.ftInfo(context.Background(), i.client)
+	if isUnknownIndex(err) {
+		return 0
 	}
-	count = int64(total)
-	return count
+	if err != nil {
+		log.Println(fmt.Sprintf("Failed to count the documents of index %s due to %v", i.name, err))
+		return -1
+	}
+	numDocs, ok := infoFloat(info, "num_docs")
+	if !ok {
+		log.Println(fmt.Sprintf("Failed to count the documents of index %s: missing num_docs in %s.INFO reply", i.name, i.commandPrefix))
+		return -1
+	}
+	return int64(numDocs)
 }
 
-func docCountShard(ctx context.Context, conn *goredis.Client) (err error) {
-	mu.Lock()
-	defer mu.Unlock()
-	res := strings.Split(conn.Do(ctx, "INFO", "KEYSPACE").String(), "\n")
-	count := int64(0)
-	if len(res) > 2 {
-		db0Slice := res[1]
-		countS := strings.Split(strings.Split(db0Slice, ",")[0], "=")[1]
-		count, err = strconv.ParseInt(countS, 10, 0)
+// WaitForIndexing polls FT.INFO until the index reports no background indexing in progress, or the timeout expires
+func (i *Index) WaitForIndexing(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for {
+		info, err := i.ftInfo(ctx, i.client)
 		if err != nil {
-			return
+			return err
+		}
+		if value, ok := infoFloat(info, "indexing"); !ok || value == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("index %s still indexing after %s: %w", i.name, timeout, ctx.Err())
+		case <-time.After(100 * time.Millisecond):
 		}
 	}
-	total = total + count
-	return
+}
+
+// the FT.INFO fields holding the memory used by each of the index structures, in MB
+var indexSizeFields = []string{"inverted_sz_mb", "vector_index_sz_mb", "offset_vectors_sz_mb", "doc_table_size_mb", "sortable_values_size_mb", "key_table_size_mb"}
+
+// IndexSize returns the memory used by the index structures, as reported by FT.INFO. In cluster mode FT.INFO is sent
+// once, like FT.CREATE, and the coordinator replies the index-wide sizes
+func (i *Index) IndexSize() (int64, error) {
+	info, err := i.ftInfo(context.Background(), i.client)
+	if err != nil {
+		return 0, err
+	}
+	sizeMB := 0.0
+	for _, field := range indexSizeFields {
+		if value, ok := infoFloat(info, field); ok {
+			sizeMB += value
+		}
+	}
+	return int64(sizeMB * 1024 * 1024), nil
+}
+
+// ftInfo returns the FT.INFO reply of the index on the given connection, as a map of the info fields
+func (i *Index) ftInfo(ctx context.Context, conn redisClient) (map[string]interface{}, error) {
+	reply, err := conn.Do(ctx, i.commandPrefix+".INFO", i.name).Slice()
+	if err != nil {
+		return nil, err
+	}
+	info := map[string]interface{}{}
+	for j := 0; j+1 < len(reply); j += 2 {
+		if field, ok := reply[j].(string); ok {
+			info[field] = reply[j+1]
+		}
+	}
+	return info, nil
+}
+
+// infoFloat returns the numeric value of an FT.INFO field, which may be replied as a string or as a number
+func infoFloat(info map[string]interface{}, field string) (float64, bool) {
+	switch v := info[field].(type) {
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
 }
 
 func (i *Index) GetName() string {
@@ -141,6 +216,14 @@ func (i *Index) GetName() string {
 // Create configues the index and creates it on redis
 func (i *Index) Create() error {
 	args := []interface{}{i.commandPrefix + ".CREATE", i.name}
+	if i.storage == "json" {
+		args = append(args, "ON", "JSON")
+	} else if i.keyPrefix != "" {
+		args = append(args, "ON", "HASH")
+	}
+	if i.keyPrefix != "" {
+		args = append(args, "PREFIX", 1, i.keyPrefix)
+	}
 	if i.temporary != -1 {
 		t := strconv.Itoa(i.temporary)
 		args = append(args, "TEMPORARY", t)
@@ -156,7 +239,16 @@ func (i *Index) Create() error {
 			if !ok {
 				return errors.New("Invalid text field options type")
 			}
-			args = append(args, f.Name, "TEXT", "WEIGHT", "1.0")
+			args = append(args, i.fieldIdentifier(f.Name)...)
+			args = append(args, "TEXT")
+			if !opts.Stemming {
+				args = append(args, "NOSTEM")
+			}
+			weight := opts.Weight
+			if weight <= 0 {
+				weight = 1
+			}
+			args = append(args, "WEIGHT", strconv.FormatFloat(float64(weight), 'f', -1, 32))
 			if opts.Sortable {
 				args = append(args, "SORTABLE")
 			}
@@ -165,7 +257,26 @@ func (i *Index) Create() error {
 			}
 
 		case index.NumericField:
-			args = append(args, f.Name, "NUMERIC")
+			args = append(args, i.fieldIdentifier(f.Name)...)
+			args = append(args, "NUMERIC")
+
+		case index.GeoField:
+			args = append(args, i.fieldIdentifier(f.Name)...)
+			args = append(args, "GEO")
+
+		case index.ValueField:
+			opts, ok := f.Options.(index.ValueFieldOptions)
+			if !ok {
+				return errors.New("Invalid value field options type")
+			}
+			args = append(args, i.fieldIdentifier(f.Name)...)
+			args = append(args, "TAG")
+			if opts.Separator != "" {
+				args = append(args, "SEPARATOR", opts.Separator)
+			}
+			if opts.CaseSensitive {
+				args = append(args, "CASESENSITIVE")
+			}
 
 		case index.NoIndexField:
 			continue
@@ -181,19 +292,96 @@ func (i *Index) Create() error {
 	return err
 }
 
-// Index indexes multiple documents on the index, with optional IndexingOptions passed to options
-func (i *Index) Index(docs []index.Document, options interface{}) error {
-	conn := i.client
-	for _, doc := range docs {
-		args := []interface{}{"HSET", doc.Id}
-		for k, f := range doc.Properties {
-			args = append(args, k, f)
+// fieldIdentifier returns the FT.CREATE schema identifier of a field. In json storage mode the field is read from
+// the top level JSONPath with the same name, and aliased to the field name so that the queries stay unchanged
+func (i *Index) fieldIdentifier(name string) []interface{} {
+	if i.storage == "json" {
+		return []interface{}{"$." + name, "AS", name}
+	}
+	return []interface{}{name}
+}
+
+// geoValue formats a location as the "lon,lat" string expected by GEO fields
+func geoValue(p index.GeoPoint) string {
+	return strconv.FormatFloat(p.Lon, 'f', -1, 64) + "," + strconv.FormatFloat(p.Lat, 'f', -1, 64)
+}
+
+// writeArgs returns the command writing a document, either a HSET or a JSON.SET of its properties
+func (i *Index) writeArgs(doc index.Document) ([]interface{}, error) {
+	key := i.keyPrefix + doc.Id
+	properties := doc.Properties
+	copied := false
+	for k, v := range doc.Properties {
+		// geo fields are stored as "lon,lat" strings both in hashes and in JSON documents
+		if point, ok := v.(index.GeoPoint); ok {
+			if !copied {
+				properties = make(map[string]interface{}, len(doc.Properties))
+				for pk, pv := range doc.Properties {
+					properties[pk] = pv
+				}
+				copied = true
+			}
+			properties[k] = geoValue(point)
 		}
-		err := conn.Do(context.Background(), args...).Err()
+	}
+	if i.storage == "json" {
+		data, err := json.Marshal(properties)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		return []interface{}{"JSON.SET", key, "$", string(data)}, nil
+	}
+	args := []interface{}{"HSET", key}
+	for k, f := range properties {
+		args = append(args, k, f)
+	}
+	return args, nil
+}
+
+// Index indexes multiple documents on the index, with optional IndexingOptions passed to options.
+// The HSET or JSON.SET commands are sent in pipelines of up to pipelineDepth commands. In cluster mode go-redis splits each
+// pipeline per node, according to the slot of each document key.
+// If some of the documents fail to be indexed the others are still indexed, and an *index.IndexingError with the
+// failed documents is returned. Only the error replies of the server fail single documents, while connection errors
+// and timeouts are returned as they are.
+func (i *Index) Index(docs []index.Document, options interface{}) error {
+	ctx := context.Background()
+	var failed []index.DocumentError
+	for start := 0; start < len(docs); start += i.pipelineDepth {
+		end := start + i.pipelineDepth
+		if end > len(docs) {
+			end = len(docs)
+		}
+		pipe := i.client.Pipeline()
+		cmds := make([]*goredis.Cmd, 0, end-start)
+		pipelined := make([]index.Document, 0, end-start)
+		for _, doc := range docs[start:end] {
+			args, err := i.writeArgs(doc)
+			if err != nil {
+				failed = append(failed, index.DocumentError{Id: doc.Id, Err: err})
+				continue
+			}
+			cmds = append(cmds, pipe.Do(ctx, args...))
+			pipelined = append(pipelined, doc)
+		}
+		// the error replies of the commands are checked below, while a connection error fails the whole call
+		if _, err := pipe.Exec(ctx); err != nil {
+			if _, ok := err.(goredis.Error); !ok {
+				return err
+			}
+		}
+		for j, cmd := range cmds {
+			if err := cmd.Err(); err != nil {
+				if _, ok := err.(goredis.Error); !ok {
+					return err
+				}
+				failed = append(failed, index.DocumentError{Id: pipelined[j].Id, Err: fmt.Errorf("%w: %v", index.ErrServer, err)})
+			}
 		}
 	}
+	if len(failed) > 0 {
+		return &index.IndexingError{Failed: failed}
+	}
 	return nil
 }
 
@@ -217,21 +405,27 @@ func (i *Index) WildCardQuery(q query.Query, verbose int) (docs []index.Document
 // the total number of results, or an error if something went wrong
 func (i *Index) FullTextQuerySingleField(q query.Query, verbose int) (docs []index.Document, total int, err error) {
 	conn := i.client
-	term := q.Term
-	if q.Flags&query.QueryTypePrefix != 0 && term[len(term)-1] != '*' {
-		term = fmt.Sprintf("%s*", term)
-	}
-	queryParam := term
-	if q.Field != "" {
-		queryParam = fmt.Sprintf("@%s:%s", q.Field, term)
+	queryParam, err := i.searchQuery(q)
+	if err != nil {
+		return nil, 0, err
 	}
 	args := []interface{}{"FT.SEARCH", i.name, queryParam, "LIMIT", q.Paging.Offset, q.Paging.Num, "WITHSCORES"}
 	sliceReply, err := conn.Do(context.Background(), args...).Slice()
 	if err != nil {
+		if _, ok := err.(goredis.Error); ok {
+			err = fmt.Errorf("%w: %v", index.ErrServer, err)
+		}
+		return
+	}
+	if len(sliceReply) == 0 {
+		err = fmt.Errorf("%w: empty reply to query %v", index.ErrParse, args)
+		return
+	}
+	n, ok := sliceReply[0].(int64)
+	if !ok {
+		err = fmt.Errorf("%w: unexpected total results reply %v to query %v", index.ErrParse, sliceReply[0], args)
 		return
 	}
-	res := sliceReply[0]
-	n := res.(int64)
 	total = int(n)
 	if verbose > 1 {
 		log.Printf(
@@ -243,15 +437,123 @@ func (i *Index) FullTextQuerySingleField(q query.Query, verbose int) (docs []ind
 	return nil, total, nil
 }
 
+// searchQuery returns the FT.SEARCH query string matching the query term on its field, and its predicates
+func (i *Index) searchQuery(q query.Query) (string, error) {
+	term := q.Term
+	if q.Flags&query.QueryTypePrefix != 0 && term != "" && term[len(term)-1] != '*' {
+		term = fmt.Sprintf("%s*", term)
+	}
+	queryParam := term
+	if q.Field != "" && term != "" {
+		queryParam = fmt.Sprintf("@%s:%s", q.Field, term)
+	}
+	for _, p := range q.Predicates {
+		filter, err := i.predicateFilter(p)
+		if err != nil {
+			return "", err
+		}
+		queryParam = strings.TrimSpace(queryParam + " " + filter)
+	}
+	if queryParam == "" {
+		queryParam = "*"
+	}
+	return queryParam, nil
+}
+
+// predicateFilter translates a predicate to a query filter, according to the type of the field it applies to
+func (i *Index) predicateFilter(p query.Predicate) (string, error) {
+	var field *index.Field
+	for j := range i.md.Fields {
+		if i.md.Fields[j].Name == p.Property {
+			field = &i.md.Fields[j]
+		}
+	}
+	if field == nil {
+		return "", fmt.Errorf("predicate on unknown field %s", p.Property)
+	}
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+	switch {
+	case field.Type == index.ValueField && (p.Operator == query.Eq || p.Operator == query.In):
+		values := make([]string, 0, len(p.Value))
+		for _, v := range p.Value {
+			values = append(values, escapeTag(fmt.Sprint(v)))
+		}
+		return fmt.Sprintf("@%s:{%s}", p.Property, strings.Join(values, " | ")), nil
+	case field.Type == index.NumericField:
+		min, max, minInclusive, maxInclusive, err := p.Range()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("@%s:[%s %s]", p.Property, numericBound(min, minInclusive, "-inf"), numericBound(max, maxInclusive, "+inf")), nil
+	case field.Type == index.GeoField && p.Operator == query.GeoRadius:
+		return fmt.Sprintf("@%s:[%v %v %v km]", p.Property, p.Value[0], p.Value[1], p.Value[2]), nil
+	}
+	return "", fmt.Errorf("unsupported predicate %s on field %s", p.Operator, p.Property)
+}
+
+// numericBound formats a bound of a numeric range, prefixed by ( when exclusive, or unbounded if nil
+func numericBound(value interface{}, inclusive bool, unbounded string) string {
+	if value == nil {
+		return unbounded
+	}
+	if inclusive {
+		return fmt.Sprint(value)
+	}
+	return fmt.Sprintf("(%v", value)
+}
+
+// escapeTag escapes the punctuation and spaces of a tag value, which would otherwise be parsed as separators
+func escapeTag(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		if strings.ContainsRune(",.<>{}[]\"':;!@#$%^&*()-+=~|/\\ ", r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Flush is a no-op, as the documents are written by Index before it returns
+func (i *Index) Flush() error {
+	return nil
+}
+
+// Close closes the connections to redis
+func (i *Index) Close() error {
+	return i.client.Close()
+}
+
 func flush(ctx context.Context, client *goredis.Client) error {
 	return client.FlushAll(ctx).Err()
 }
 
+// Drop deletes the index and its documents. An index that doesn't exist is ignored.
+// If the index was created with flushDB the whole database is flushed instead, including any unrelated data. Without
+// keyPrefix the index covers every key of the database, so only the index is dropped and the documents are kept.
 func (i *Index) Drop() (err error) {
-	if i.cluster {
-		err = i.clientClient.ForEachMaster(context.Background(), flush)
-	} else {
-		err = i.client.FlushDB(context.Background()).Err()
+	if i.flushDB {
+		if i.cluster {
+			err = i.clientClient.ForEachMaster(context.Background(), flush)
+		} else {
+			err = i.client.FlushDB(context.Background()).Err()
+		}
+		return
+	}
+	args := []interface{}{i.commandPrefix + ".DROPINDEX", i.name}
+	if i.keyPrefix != "" {
+		args = append(args, "DD")
+	}
+	err = i.client.Do(context.Background(), args...).Err()
+	if isUnknownIndex(err) {
+		err = nil
 	}
 	return
 }
+
+// isUnknownIndex returns whether err is the error replied for an index that doesn't exist
+func isUnknownIndex(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "unknown index")
+}
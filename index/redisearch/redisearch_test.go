@@ -1,8 +1,13 @@
+//go:build integration
+
+// These tests need a redis server with the search module on localhost:6379, and are only built with the integration tag
+
 package redisearch
 
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/RediSearch/RediSearchBenchmark/index"
 	"github.com/RediSearch/RediSearchBenchmark/query"
@@ -10,12 +15,11 @@ import (
 )
 
 func TestIndex(t *testing.T) {
-	// todo: run redisearch automatically
-	//t.SkipNow()
 	md := index.NewMetadata().AddField(index.NewTextField("title", 1.0)).
 		AddField(index.NewNumericField("score"))
 
-	idx := NewIndex("localhost:6379", "testung", md)
+	idx := NewIndex([]string{"localhost:6379"}, "", -1, "testung", md, "single", false, 100, false, "testung:", "hash")
+	defer idx.Close()
 
 	docs := []index.Document{
 		index.NewDocument("doc1", 0.1).Set("title", "hello world").Set("score", 1),
@@ -26,23 +30,25 @@ func TestIndex(t *testing.T) {
 	assert.NoError(t, idx.Create())
 
 	assert.NoError(t, idx.Index(docs, nil))
+	assert.NoError(t, idx.WaitForIndexing(time.Minute))
+	assert.Equal(t, int64(2), idx.DocumentCount())
 
 	q := query.NewQuery(idx.name, "hello world")
-	docs, total, err := idx.FullTextQuerySingleField(*q)
+	_, total, err := idx.FullTextQuerySingleField(*q, 0)
 	assert.NoError(t, err)
-	assert.True(t, total > 0)
-	assert.Len(t, docs, 1)
-	assert.Equal(t, docs[0].Id, "doc1")
-	assert.Equal(t, docs[0].Properties["title"], "hello world")
+	assert.Equal(t, 1, total)
 
 	q = query.NewQuery(idx.name, "hello")
-	docs, total, err = idx.FullTextQuerySingleField(*q)
+	_, total, err = idx.FullTextQuerySingleField(*q, 0)
 	assert.NoError(t, err)
 	assert.Equal(t, 2, total)
-	assert.Len(t, docs, 2)
-	assert.Equal(t, docs[0].Id, "doc2")
-	assert.Equal(t, docs[1].Id, "doc1")
 
+	q = query.NewQuery(idx.name, "hello").AddPredicate(query.GreaterThan("score", 1))
+	_, total, err = idx.FullTextQuerySingleField(*q, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+
+	assert.NoError(t, idx.Drop())
 }
 
 func TestPaging(t *testing.T) {
@@ -50,7 +56,8 @@ func TestPaging(t *testing.T) {
 	md := index.NewMetadata().AddField(index.NewTextField("title", 1.0)).
 		AddField(index.NewNumericField("score"))
 
-	idx := NewDistributedIndex("td", []string{"localhost:6379"}, 4, md)
+	idx := NewIndex([]string{"localhost:6379"}, "", -1, "td", md, "single", false, 100, false, "td:", "hash")
+	defer idx.Close()
 
 	assert.NoError(t, idx.Drop())
 	assert.NoError(t, idx.Create())
@@ -62,90 +69,16 @@ func TestPaging(t *testing.T) {
 
 	}
 	assert.NoError(t, idx.Index(docs, nil))
+	assert.NoError(t, idx.WaitForIndexing(time.Minute))
 	q := query.NewQuery("td", "hello").Limit(10, 10)
-	docs, total, err := idx.Search(*q)
-
+	_, total, err := idx.FullTextQuerySingleField(*q, 0)
 	assert.NoError(t, err)
-	assert.Len(t, docs, 10)
-	assert.Equal(t, docs[0].Id, "doc89")
 	assert.Equal(t, N, total)
 
 	q = query.NewQuery("td", "title80").Limit(0, 1)
-	docs, total, err = idx.Search(*q)
-	assert.Len(t, docs, 1)
-	assert.Equal(t, docs[0].Id, "doc80")
-	assert.Equal(t, 1, total)
-
-	q = query.NewQuery("td", "title80").Limit(5, 1)
-	docs, total, err = idx.Search(*q)
+	_, total, err = idx.FullTextQuerySingleField(*q, 0)
 	assert.NoError(t, err)
-	assert.Len(t, docs, 0)
-}
-func TestDistributedIndex(t *testing.T) {
-	// todo: run redisearch automatically
-	//st.SkipNow()
-	md := index.NewMetadata().AddField(index.NewTextField("title", 1.0)).
-		AddField(index.NewNumericField("score"))
-
-	idx := NewDistributedIndex("dtest", []string{"localhost:6379"}, 2, md)
-
-	docs := []index.Document{
-		index.NewDocument("doc1", 0.1).Set("title", "hello world").Set("score", 1),
-		index.NewDocument("doc2", 1.0).Set("title", "foo bar hello").Set("score", 2),
-	}
+	assert.Equal(t, 1, total)
 
 	assert.NoError(t, idx.Drop())
-	assert.NoError(t, idx.Create())
-
-	assert.NoError(t, idx.Index(docs, nil))
-
-	q := query.NewQuery("dtest", "hello world")
-	docs, total, err := idx.Search(*q)
-	assert.NoError(t, err)
-	assert.True(t, total > 0)
-	assert.Len(t, docs, 1)
-	assert.Equal(t, docs[0].Id, "doc1")
-	assert.Equal(t, docs[0].Properties["title"], "hello world")
-
-	q = query.NewQuery("dtest", "hello")
-	docs, total, err = idx.Search(*q)
-	t.Log(docs, total, err)
-	assert.NoError(t, err)
-	assert.Equal(t, 2, total)
-	assert.Len(t, docs, 2)
-	assert.Equal(t, docs[0].Id, "doc2")
-	assert.Equal(t, docs[1].Id, "doc1")
-
-	suggs := []index.Suggestion{}
-	for i := 0; i < 100; i++ {
-		suggs = append(suggs, index.Suggestion{fmt.Sprintf("suggestion %d", i), float64(i)})
-	}
-
-	assert.NoError(t, idx.AddTerms(suggs...))
-
-	suggs, err = idx.Suggest("sugg", 10, false)
-	assert.NoError(t, err)
-	fmt.Println(suggs)
-	assert.Len(t, suggs, 10)
-
-}
-
-func TestAutocompleter(t *testing.T) {
-	//t.SkipNow()
-	ac := NewAutocompleter("localhost:6379", "ac")
-
-	assert.NotNil(t, ac)
-	assert.NoError(t, ac.AddTerms(
-		index.Suggestion{"hello world", 1},
-		index.Suggestion{"hello", 2},
-		index.Suggestion{"jello world", 3},
-	))
-
-	suggs, err := ac.Suggest("hel", 10, false)
-	assert.NoError(t, err)
-	assert.Len(t, suggs, 2)
-
-	suggs, err = ac.Suggest("hel", 10, true)
-	assert.NoError(t, err)
-	assert.Len(t, suggs, 3)
 }
@@ -13,9 +13,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/RediSearch/RediSearchBenchmark/index"
+	"github.com/RediSearch/RediSearchBenchmark/synth"
 )
 
 // DocumentReader implements parsing a data source and yielding documents
@@ -23,6 +26,33 @@ type DocumentReader interface {
 	Read(io.Reader, chan index.Document, int, index.Index) error
 }
 
+// locationsReader adds a synthetic location to the documents yielded by a DocumentReader
+type locationsReader struct {
+	reader    DocumentReader
+	field     string
+	locations *synth.LocationGenerator
+}
+
+// WithLocations returns a DocumentReader setting field to a location generated by locations on each of the documents
+// yielded by r, for the datasets without geo data
+func WithLocations(r DocumentReader, field string, locations *synth.LocationGenerator) DocumentReader {
+	return &locationsReader{reader: r, field: field, locations: locations}
+}
+
+func (lr *locationsReader) Read(r io.Reader, ch chan index.Document, maxDocsToRead int, idx index.Index) error {
+	docs := make(chan index.Document, cap(ch))
+	if err := lr.reader.Read(r, docs, maxDocsToRead, idx); err != nil {
+		return err
+	}
+	go func() {
+		for doc := range docs {
+			ch <- doc.Set(lr.field, lr.locations.Generate())
+		}
+		close(ch)
+	}()
+	return nil
+}
+
 var nonAlphanumericRegex = regexp.MustCompile(`[^a-zA-Z0-9 ]+`)
 
 func walkDir(path string, pattern string, ch chan string) {
@@ -54,6 +84,12 @@ func walkDir(path string, pattern string, ch chan string) {
 	}
 }
 
+// BatchCallback is called by the indexing workers after each call to Index, with the batch of documents, the time
+// Index took, and the error it returned
+type BatchCallback func(batch []index.Document, took time.Duration, err error)
+
+// Stats holds the progress of an ingestion. The current window values cover the last reporting period, and
+// CurrentWindowLatency is the average latency of the batches indexed in it
 type Stats struct {
 	TotalDocs             int64
 	CurrentWindowDocs     int
@@ -62,6 +98,70 @@ type Stats struct {
 	CurrentWindowLatency  time.Duration
 }
 
+// progress accumulates the documents and batch latencies indexed by the workers of ReadFile between two reports
+type progress struct {
+	sync.Mutex
+	stats         Stats
+	windowStart   time.Time
+	windowBatches int
+	windowLatency time.Duration
+}
+
+// add accounts a batch of docs successfully indexed in took
+func (p *progress) add(docs int, took time.Duration) {
+	p.Lock()
+	p.stats.TotalDocs += int64(docs)
+	p.stats.CurrentWindowDocs += docs
+	p.windowBatches++
+	p.windowLatency += took
+	p.Unlock()
+}
+
+// rotate closes the current window at now, returning its stats, and starts a new one
+func (p *progress) rotate(now time.Time) Stats {
+	p.Lock()
+	defer p.Unlock()
+	stats := p.stats
+	stats.CurrentWindowDuration = now.Sub(p.windowStart)
+	if stats.CurrentWindowDuration > 0 {
+		stats.CurrentWindowRate = float64(stats.CurrentWindowDocs) / stats.CurrentWindowDuration.Seconds()
+	}
+	if p.windowBatches > 0 {
+		stats.CurrentWindowLatency = p.windowLatency / time.Duration(p.windowBatches)
+	}
+	p.stats.CurrentWindowDocs = 0
+	p.windowStart = now
+	p.windowBatches = 0
+	p.windowLatency = 0
+	return stats
+}
+
+// reportProgress logs the ingestion progress every period until done is closed. The ETA is only known when
+// maxDocs is set
+func reportProgress(p *progress, period time.Duration, maxDocs int64, done <-chan struct{}) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		var now time.Time
+		select {
+		case <-done:
+			return
+		case now = <-ticker.C:
+		}
+		stats := p.rotate(now)
+		eta := ""
+		if maxDocs > 0 && stats.CurrentWindowRate > 0 {
+			remaining := time.Duration(float64(maxDocs-stats.TotalDocs)/stats.CurrentWindowRate) * time.Second
+			if remaining < 0 {
+				remaining = 0
+			}
+			eta = fmt.Sprintf(", ETA %s", remaining.Round(time.Second))
+		}
+		log.Println(fmt.Sprintf("Indexed %d documents, %.0f docs/sec, average batch latency %s%s",
+			stats.TotalDocs, stats.CurrentWindowRate, stats.CurrentWindowLatency.Round(time.Microsecond), eta))
+	}
+}
+
 // IngestDocuments ingests documents into an index using a DocumentReader
 func ReadTerms(fileName string, r DocumentReader, idx index.Index, chunk int, maxDocsToRead int, maxTermsToProduce int, propertyName string, termStopWords []string) (finalTerms []string, err error) {
 	// open the file
@@ -102,8 +202,56 @@ func ReadTerms(fileName string, r DocumentReader, idx index.Index, chunk int, ma
 	return
 }
 
-// IngestDocuments ingests documents into an index using a DocumentReader
-func ReadFile(fileName string, r DocumentReader, idx index.Index, opts interface{}, chunk int, maxDocsToRead int64, indexingWorkers int) error {
+// ReadNumericRange returns the min and max values of a numeric property over the first maxDocsToRead documents of
+// a file, to generate range queries matching the dataset
+func ReadNumericRange(fileName string, r DocumentReader, idx index.Index, maxDocsToRead int, propertyName string) (min, max float64, err error) {
+	fp, err := os.Open(fileName)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+	ch := make(chan index.Document)
+	if err = r.Read(fp, ch, maxDocsToRead, idx); err != nil {
+		return
+	}
+	found := false
+	for doc := range ch {
+		var value float64
+		switch v := doc.Properties[propertyName].(type) {
+		case int64:
+			value = float64(v)
+		case int:
+			value = float64(v)
+		case float64:
+			value = v
+		default:
+			continue
+		}
+		if !found || value < min {
+			min = value
+		}
+		if !found || value > max {
+			max = value
+		}
+		found = true
+	}
+	if !found {
+		err = fmt.Errorf("no numeric %s property found in %s", propertyName, fileName)
+	}
+	return
+}
+
+// ReadFile ingests documents into an index using a DocumentReader.
+// The documents are indexed by indexingWorkers go-routines, each calling idx.Index with batches of chunk documents.
+// When idx is an index.AsyncIndex a batch completes, and is reported, once all its documents were written rather than
+// buffered, and the index is flushed at the end.
+// The reader blocks once the workers fall behind, so the documents read but not indexed yet are bounded.
+// Documents that failed to be indexed (an *index.IndexingError) don't stop the ingestion, and are returned together in
+// a single *index.IndexingError at the end. Any other error is returned right away, after which the workers stop
+// indexing and the rest of the input is discarded.
+// If onBatch is not nil it is called after each batch, possibly from other go-routines.
+// The progress is logged every reportingPeriod, unless it is 0.
+func ReadFile(fileName string, r DocumentReader, idx index.Index, opts interface{}, chunk int, maxDocsToRead int64, indexingWorkers int, onBatch BatchCallback, reportingPeriod time.Duration) error {
 
 	// open the file
 	fp, err := os.Open(fileName)
@@ -111,23 +259,136 @@ func ReadFile(fileName string, r DocumentReader, idx index.Index, opts interface
 		return err
 	}
 	defer fp.Close()
-	ch := make(chan index.Document, chunk)
+	if chunk < 1 {
+		chunk = 1
+	}
+	if indexingWorkers < 1 {
+		indexingWorkers = 1
+	}
+	ch := make(chan index.Document, chunk*indexingWorkers)
 	// run the reader and let it spawn a goroutine
 	if err := r.Read(fp, ch, int(maxDocsToRead), idx); err != nil {
 		return err
 	}
 
-	numOfDocs := 0
-	for doc := range ch {
-		if doc.Id != "" {
-			err = idx.Index([]index.Document{doc}, opts)
-			if err != nil {
-				log.Fatal(err)
+	p := &progress{windowStart: time.Now()}
+	reportDone := make(chan struct{})
+	defer close(reportDone)
+	if reportingPeriod > 0 {
+		go reportProgress(p, reportingPeriod, maxDocsToRead, reportDone)
+	}
+
+	var indexingErr error
+	var failed int32
+	var errOnce sync.Once
+	var docErrs []index.DocumentError
+	var docErrsMutex sync.Mutex
+	reportBatch := func(batch []index.Document, took time.Duration, err error) {
+		if onBatch != nil {
+			onBatch(batch, took, err)
+		}
+		if err == nil {
+			p.add(len(batch), took)
+		} else if ie, ok := err.(*index.IndexingError); ok {
+			p.add(len(batch)-len(ie.Failed), took)
+			docErrsMutex.Lock()
+			docErrs = append(docErrs, ie.Failed...)
+			docErrsMutex.Unlock()
+		} else {
+			errOnce.Do(func() {
+				indexingErr = err
+				atomic.StoreInt32(&failed, 1)
+			})
+		}
+	}
+	// the batches passed to an AsyncIndex are reported once all their documents were written
+	asyncIdx, async := idx.(index.AsyncIndex)
+	pending := sync.WaitGroup{}
+	indexBatch := func(batch []index.Document) bool {
+		tst := time.Now()
+		if async {
+			pending.Add(1)
+			b := &asyncBatch{start: tst, remaining: len(batch), report: func(took time.Duration, err error) {
+				reportBatch(batch, took, err)
+				pending.Done()
+			}}
+			if err := asyncIdx.IndexAsync(batch, opts, b.done); err != nil {
+				b.report(time.Since(tst), err)
 			}
-			numOfDocs++
 		} else {
-			fmt.Println("warning empty id")
+			err := idx.Index(batch, opts)
+			reportBatch(batch, time.Since(tst), err)
 		}
+		return atomic.LoadInt32(&failed) == 0
 	}
-	return nil
+	wg := sync.WaitGroup{}
+	for i := 0; i < indexingWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			batch := make([]index.Document, 0, chunk)
+			for doc := range ch {
+				if doc.Id == "" {
+					fmt.Println("warning empty id")
+					continue
+				}
+				batch = append(batch, doc)
+				if len(batch) < chunk {
+					continue
+				}
+				if !indexBatch(batch) {
+					return
+				}
+				batch = make([]index.Document, 0, chunk)
+			}
+			if len(batch) > 0 {
+				indexBatch(batch)
+			}
+		}()
+	}
+	wg.Wait()
+	if indexingErr != nil {
+		// unblock the reader, which closes ch once done
+		for range ch {
+		}
+		return indexingErr
+	}
+	var flushErr error
+	if async {
+		if flushErr = idx.Flush(); flushErr == nil {
+			pending.Wait()
+		}
+	}
+	docErrsMutex.Lock()
+	defer docErrsMutex.Unlock()
+	if len(docErrs) > 0 {
+		return &index.IndexingError{Failed: docErrs}
+	}
+	return flushErr
+}
+
+// asyncBatch collects the results of the documents of a batch passed to an index.AsyncIndex, and reports the batch
+// once all of them were written
+type asyncBatch struct {
+	sync.Mutex
+	start     time.Time
+	remaining int
+	failed    []index.DocumentError
+	report    func(took time.Duration, err error)
+}
+
+func (b *asyncBatch) done(doc index.Document, err error) {
+	b.Lock()
+	defer b.Unlock()
+	if err != nil {
+		b.failed = append(b.failed, index.DocumentError{Id: doc.Id, Err: err})
+	}
+	if b.remaining--; b.remaining > 0 {
+		return
+	}
+	var batchErr error
+	if len(b.failed) > 0 {
+		batchErr = &index.IndexingError{Failed: b.failed}
+	}
+	b.report(time.Since(b.start), batchErr)
 }
@@ -46,27 +46,27 @@ func (rr *RedditReader) Read(r io.Reader, ch chan index.Document, maxDocsToRead
 	bz := bzip2.NewReader(r)
 	jr := json.NewDecoder(bz)
 
-	var rd redditDocument
-
-	//go func() {
-	var err error
-
-	for err != io.EOF {
-
-		if err := jr.Decode(&rd); err != nil {
-			log.Printf("Error decoding json: %s", err)
-			break
-		}
-		doc := index.NewDocument(rd.Id, float32(math.Max(0, float64(rd.Score)))/1000).
-			Set("body", rd.Body).
-			Set("author", rd.Author).
-			Set("sub", rd.Subreddit).
-			Set("date", int64(rd.Created))
+	go func() {
+		docsRead := 0
+		for maxDocsToRead == -1 || docsRead < maxDocsToRead {
+			var rd redditDocument
+			if err := jr.Decode(&rd); err != nil {
+				if err != io.EOF {
+					log.Printf("Error decoding json: %s", err)
+				}
+				break
+			}
+			doc := index.NewDocument(rd.Id, float32(math.Max(0, float64(rd.Score)))/1000).
+				Set("body", rd.Body).
+				Set("author", rd.Author).
+				Set("sub", rd.Subreddit).
+				Set("date", int64(rd.Created))
 			//Set("ups", rd.Ups)
 
-		ch <- doc
-	}
-	//close(ch)
-	//}()
+			ch <- doc
+			docsRead++
+		}
+		close(ch)
+	}()
 	return nil
 }
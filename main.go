@@ -1,13 +1,16 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"math/rand"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"text/tabwriter"
 	"time"
 
@@ -20,6 +23,7 @@ import (
 	"github.com/RediSearch/RediSearchBenchmark/index/redisearch"
 	"github.com/RediSearch/RediSearchBenchmark/ingest"
 	"github.com/RediSearch/RediSearchBenchmark/query"
+	"github.com/RediSearch/RediSearchBenchmark/synth"
 )
 
 const (
@@ -30,19 +34,32 @@ const (
 	REDDIT_DATASET            = "reddit"
 	DEFAULT_DATASET           = EN_WIKI_DATASET
 	BENCHMARK_SEARCH          = "search"
+	BENCHMARK_SEARCH_FILTERED = "search-filtered"
 	BENCHMARK_PREFIX          = "prefix"
 	BENCHMARK_CONTAINS        = "contains"
 	BENCHMARK_SUFFIX          = "suffix"
 	BENCHMARK_WILDCARD        = "wildcard"
+	BENCHMARK_MIXED           = "mixed"
+	BENCHMARK_GEO             = "geo"
+	COMMAND_INDEX             = "index"
 	BENCHMARK_DEFAULT         = BENCHMARK_SEARCH
 	ENGINE_REDIS              = "redis"
 	ENGINE_ELASTIC            = "elastic"
 	TERM_QUERY_MAX_LEN        = "term-query-prefix-max-len"
+	MIXED_WEIGHTS             = "mixed-weights"
 	ENGINE_DEFAULT            = ENGINE_REDIS
 	DEFAULT_STOPWORDS         = "a,an,and,are,as,at,be,but,by,for,if,in,into,is,it,no,not,of,on,or,such,that,the,their,then,there,these,they,this,to,was,will,with"
 	REDIS_MODE_SINGLE         = "single"
 	REDIS_MODULE_OSS_CLUSTER  = "cluster"
 	REDIS_MODE_SINGLE_DEFAULT = REDIS_MODE_SINGLE
+	REDIS_STORAGE_HASH        = "hash"
+	REDIS_STORAGE_JSON        = "json"
+	REDIS_STORAGE_DEFAULT     = REDIS_STORAGE_HASH
+	// the bounding box of the synthetic locations, within the latitudes supported by redis
+	GEO_MIN_LON = -180.0
+	GEO_MIN_LAT = -85.0
+	GEO_MAX_LON = 180.0
+	GEO_MAX_LAT = 85.0
 )
 
 // this mutex does not affect any of the client go-routines ( it's only to sync between main thread and datapoints processer go-routines )
@@ -55,7 +72,7 @@ var indexMetadataEnWiki = index.NewMetadata().
 
 var indexMetadataPMC = index.NewMetadata().
 	AddField(index.NewTextField("accession", 1)).
-	AddField(index.NewTextField("journal", 1)).
+	AddField(index.NewValueField("journal")).
 	AddField(index.NewTextField("name", 1)).
 	AddField(index.NewNumericField("timestamp")).
 	AddField(index.NewTextField("date", 1)).
@@ -64,13 +81,39 @@ var indexMetadataPMC = index.NewMetadata().
 	AddField(index.NewTextField("body", 1)).
 	AddField(index.NewTextField("issue", 1))
 
+var indexMetadataReddit = index.NewMetadata().
+	AddField(index.NewTextField("body", 1)).
+	AddField(index.NewTextField("author", 1)).
+	AddField(index.NewValueField("sub")).
+	AddField(index.NewNumericField("date"))
+
+// newDocumentReader returns the reader of the input files of the given dataset. If geoField is set the reader adds a
+// synthetic location to every document
+func newDocumentReader(dataset string, geoField string, seed int64) ingest.DocumentReader {
+	var reader ingest.DocumentReader
+	switch dataset {
+	case EN_WIKI_DATASET:
+		reader = &ingest.WikipediaAbstractsReader{}
+	case REDDIT_DATASET:
+		reader = &ingest.RedditReader{}
+	case PMC_DATASET:
+		reader = &ingest.PmcReader{}
+	default:
+		return nil
+	}
+	if geoField != "" {
+		reader = ingest.WithLocations(reader, geoField, synth.NewLocationGenerator(seed, GEO_MIN_LON, GEO_MIN_LAT, GEO_MAX_LON, GEO_MAX_LAT))
+	}
+	return reader
+}
+
 // selectIndex selects and configures the index we are now running based on the engine name, hosts and number of shards
-func selectIndex(indexMetadata *index.Metadata, engine string, hosts []string, user, pass string, temporary int, disableCache bool, name string, cmdPrefix string, shardCount, replicaCount, indexerNumCPUs int, tlsSkipVerify bool, bulkIndexerFlushIntervalSeconds int, bulkIndexerRefresh string, redisMode string, withSuffixTrie bool) (index.Index, interface{}) {
+func selectIndex(indexMetadata *index.Metadata, engine string, hosts []string, user, pass string, temporary int, disableCache bool, name string, cmdPrefix string, shardCount, replicaCount, indexerNumCPUs int, tlsSkipVerify bool, bulkIndexerFlushIntervalSeconds int, bulkIndexerRefresh string, redisMode string, withSuffixTrie bool, redisPipelineDepth int, redisFlushDB bool, redisKeyPrefix string, redisStorage string) (index.Index, interface{}) {
 
 	switch engine {
 	case ENGINE_REDIS:
 		indexMetadata.Options = redisearch.IndexingOptions{Prefix: cmdPrefix}
-		idx := redisearch.NewIndex(hosts, pass, temporary, name, indexMetadata, redisMode, withSuffixTrie)
+		idx := redisearch.NewIndex(hosts, pass, temporary, name, indexMetadata, redisMode, withSuffixTrie, redisPipelineDepth, redisFlushDB, redisKeyPrefix, redisStorage)
 		return idx, query.QueryVerbatim
 	case ENGINE_ELASTIC:
 		idx, err := elastic.NewIndex(hosts[0], name, "doc", disableCache, indexMetadata, user, pass, shardCount, replicaCount, indexerNumCPUs, tlsSkipVerify, bulkIndexerFlushIntervalSeconds, bulkIndexerRefresh)
@@ -93,14 +136,24 @@ func main() {
 	totalTerms := flag.Int("distinct-terms", 100000, "When reading terms from input files how many terms should be read.")
 	queryField := flag.String("benchmark-query-fieldname", "", "fieldname to use for search|prefix|wildcard benchmarks. If empty will use the default per dataset.")
 	randomSeed := flag.Int64("seed", 12345, "PRNG seed.")
+	filterField := flag.String("filter-field", "", fmt.Sprintf("Numeric field filtered by the %s benchmark. If empty will use the default per dataset: 'timestamp' on 'pmc', 'date' on 'reddit'.", BENCHMARK_SEARCH_FILTERED))
+	filterWindowRatio := flag.Float64("filter-window-ratio", 0.1, fmt.Sprintf("Width of the random windows of the %s benchmark, as a ratio in (0, 1] of the filter field range of values.", BENCHMARK_SEARCH_FILTERED))
+	geoField := flag.String("geo-field", "", fmt.Sprintf("Name of a geo field holding a synthetic location added to every document, queried by the %s benchmark. If empty no location is added.", BENCHMARK_GEO))
+	geoRadius := flag.Float64("geo-radius-km", 100, fmt.Sprintf("Radius in kilometers of the %s benchmark queries.", BENCHMARK_GEO))
 	termStopWords := flag.String("stopwords", DEFAULT_STOPWORDS, "filtered stopwords for term creation")
 	dataset := flag.String("dataset", DEFAULT_DATASET, fmt.Sprintf("The dataset tp process. One of: [%s]", strings.Join([]string{EN_WIKI_DATASET, REDDIT_DATASET, PMC_DATASET}, "|")))
-	benchmark := flag.String("benchmark", "", fmt.Sprintf("The benchmark to run. One of: [%s]. If empty will not run.", strings.Join([]string{BENCHMARK_SEARCH, BENCHMARK_PREFIX, BENCHMARK_WILDCARD, BENCHMARK_CONTAINS, BENCHMARK_SUFFIX}, "|")))
+	benchmark := flag.String("benchmark", "", fmt.Sprintf("The benchmark to run. One of: [%s]. If empty will not run.", strings.Join([]string{BENCHMARK_SEARCH, BENCHMARK_SEARCH_FILTERED, BENCHMARK_PREFIX, BENCHMARK_WILDCARD, BENCHMARK_CONTAINS, BENCHMARK_SUFFIX, BENCHMARK_MIXED, BENCHMARK_GEO}, "|")))
+	mixedWeights := flag.String(MIXED_WEIGHTS, "search=70,prefix=20,wildcard=10", fmt.Sprintf("Comma separated list of query type=weight pairs for the %s benchmark. The query type of each request is picked with a probability proportional to its weight.", BENCHMARK_MIXED))
 
 	tlsSkipVerify := flag.Bool("tls-skip-verify", true, "Skip verification of server certificate.")
 	seconds := flag.Int("duration", 60, "number of seconds to run the benchmark")
+	warmup := flag.Duration("warmup", 0, "Duration to run the benchmark before starting the measurements. The requests issued during the warm-up are excluded from the results.")
 	temporary := flag.Int("temporary", -1, "for redisearch only, create a temporary index that will expire after the given amount of seconds, -1 mean no temporary")
 	conc := flag.Int("c", runtimeCPUs, "benchmark concurrency")
+	errorBudget := flag.Int64("error-budget", -1, "Maximum number of failed requests tolerated before aborting the benchmark, -1 for no limit")
+	writers := flag.Int("writers", 0, "Number of writers indexing documents from the input file while the query benchmark runs, overwriting the already indexed ones. If 0 no documents are indexed during the benchmark.")
+	writersMaxRps := flag.Int64("writers-max-rps", 0, "Max global rate of documents per second indexed by the writers. If 0 no limit is applied.")
+	maxRps := flag.Int64("max-rps", 0, "Max global rate of requests per second, spread across the benchmark workers. If 0 no limit is applied and each worker issues requests back to back.")
 	debugLevel := flag.Int("debug-level", 0, "print debug info according to debug level. If 0 disabled.")
 	maxDocPerIndex := flag.Int64("maxdocs", -1, "specify the number of max docs per index, -1 for no limit")
 	outfile := flag.String("o", "benchmark.json", "results output file. set to - for stdout")
@@ -115,6 +168,12 @@ func main() {
 	cmdPrefix := flag.String("redis.cmd.prefix", "FT", "Command prefix for FT module")
 	redisMode := flag.String("redis.mode", REDIS_MODE_SINGLE_DEFAULT, fmt.Sprintf("Redis connection mode. One of: [%s]", strings.Join([]string{REDIS_MODE_SINGLE, REDIS_MODULE_OSS_CLUSTER}, "|")))
 	verbatimEnabled := flag.Bool("redis.verbatim", false, "for redisearch only. does not try to use stemming for query expansion but searches the query terms verbatim.")
+	redisPipelineDepth := flag.Int("redis.pipeline", 100, "for redisearch only. Max number of commands sent in a single pipeline when indexing documents.")
+	indexName := flag.String("index", IndexNamePrefix+strconv.Itoa(0), "Name of the index to create and query. Use distinct names to keep several indexes on the same server, as the redis key prefix defaults to the index name.")
+	redisStorage := flag.String("redis.storage", REDIS_STORAGE_DEFAULT, fmt.Sprintf("for redisearch only. How the documents are stored. One of: [%s]", strings.Join([]string{REDIS_STORAGE_HASH, REDIS_STORAGE_JSON}, ",")))
+	redisKeyPrefix := flag.String("redis.key.prefix", "", "for redisearch only. Prefix prepended to the document keys. The index is created ON HASH PREFIX, so that it only indexes the keys with that prefix. Defaults to the index name followed by a colon.")
+	redisFlushDB := flag.Bool("redis.flush-db", false, "for redisearch only. Drop the data by flushing the whole database (FLUSHDB, or FLUSHALL on every cluster master) instead of dropping only the index and its documents. Wipes any unrelated data.")
+	redisIndexingTimeout := flag.Duration("redis.indexing-timeout", 10*time.Minute, "for redisearch only. Max time to wait for the background indexing to finish before verifying the number of indexed documents.")
 	withsuffixtrieEnabled := flag.Bool("redis.withsuffixtrie", false, "It is used to optimize contains (*foo*) and suffix (*foo) queries.")
 
 	// elastic
@@ -125,6 +184,12 @@ func main() {
 	bulkIndexerFlushIntervalSeconds := flag.Int("es.bulk.flush_interval_secs", 1, "ES bulk indexer flush interval.")
 
 	nIdx := 1
+	flag.Parse()
+	if *fileName == "" {
+		fmt.Fprintln(os.Stderr, "No input file specified")
+		flag.Usage()
+		os.Exit(-1)
+	}
 	benchmarkQueryField := *queryField
 	if benchmarkQueryField == "" {
 		switch *dataset {
@@ -132,16 +197,11 @@ func main() {
 			benchmarkQueryField = "body"
 		case PMC_DATASET:
 			benchmarkQueryField = "body"
+		case REDDIT_DATASET:
+			benchmarkQueryField = "body"
 		}
 	}
 
-	flag.Parse()
-	if *fileName == "" {
-		fmt.Fprintln(os.Stderr, "No input file specified")
-		flag.Usage()
-		os.Exit(-1)
-	}
-
 	rand.Seed(*randomSeed)
 	duration := time.Second * time.Duration(*seconds)
 	servers := strings.Split(*hosts, ",")
@@ -165,6 +225,11 @@ func main() {
 		indexMetadata = indexMetadataEnWiki
 	case PMC_DATASET:
 		indexMetadata = indexMetadataPMC
+	case REDDIT_DATASET:
+		indexMetadata = indexMetadataReddit
+	}
+	if *geoField != "" {
+		indexMetadata.AddField(index.NewGeoField(*geoField))
 	}
 
 	log.Printf("Using a total of %d concurrent benchmark workers", *conc)
@@ -173,12 +238,28 @@ func main() {
 		log.Println("Enabling VERBATIM mode on FullTextQuerySingleField benchmarks.")
 		opts = query.QueryVerbatim
 	}
+	if *redisStorage != REDIS_STORAGE_HASH && *redisStorage != REDIS_STORAGE_JSON {
+		log.Fatalf("Invalid redis.storage %s", *redisStorage)
+	}
 	// select index to run
-	name := IndexNamePrefix + strconv.Itoa(0)
-	idx, _ := selectIndex(indexMetadata, *engine, servers, username, *password, *temporary, !*elasticEnableCache, name, *cmdPrefix, *elasticShardCount, *elasticReplicaCount, *conc, *tlsSkipVerify, *bulkIndexerFlushIntervalSeconds, *bulkIndexerRefresh, *redisMode, *withsuffixtrieEnabled)
+	name := *indexName
+	if *redisKeyPrefix == "" {
+		*redisKeyPrefix = name + ":"
+	}
+	idx, _ := selectIndex(indexMetadata, *engine, servers, username, *password, *temporary, !*elasticEnableCache, name, *cmdPrefix, *elasticShardCount, *elasticReplicaCount, *conc, *tlsSkipVerify, *bulkIndexerFlushIntervalSeconds, *bulkIndexerRefresh, *redisMode, *withsuffixtrieEnabled, *redisPipelineDepth, *redisFlushDB, *redisKeyPrefix, *redisStorage)
 	indexes[0] = idx
+	var dbConfigs map[string]interface{}
+	if *engine == ENGINE_REDIS {
+		dbConfigs = map[string]interface{}{"storage": *redisStorage}
+	}
 
 	if *benchmark != "" {
+		// stop the benchmark gracefully on SIGINT/SIGTERM, a second signal terminates the process right away
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
 		w := new(tabwriter.Writer)
 		w.Init(os.Stderr, 20, 0, 0, ' ', tabwriter.AlignRight)
 		log.Println("Using input file to produce terms for the benchmarks")
@@ -193,38 +274,142 @@ func main() {
 			if queries, err = ingest.ReadTerms(*fileName, wr, indexes[0], 0, 10000, *totalTerms, *termsProperty, strings.Split(*termStopWords, ",")); err != nil {
 				log.Fatalf("Failed on Term preparation due to %v", err)
 			}
+		case REDDIT_DATASET:
+			wr := &ingest.RedditReader{}
+			if queries, err = ingest.ReadTerms(*fileName, wr, indexes[0], 0, 10000, *totalTerms, *termsProperty, strings.Split(*termStopWords, ",")); err != nil {
+				log.Fatalf("Failed on Term preparation due to %v", err)
+			}
 		}
 		returnCode := 0
+		// newQueryBenchmark returns the function for the benchmarker to run for a given query type, or nil if the
+		// query type is unknown
+		newQueryBenchmark := func(queryType string) func() (string, error) {
+			switch queryType {
+			case BENCHMARK_CONTAINS:
+				return ContainsBenchmark(queries, benchmarkQueryField, indexes[0], *termQueryPrefixMinLen, *termQueryPrefixMaxLen, *debugLevel)
+			case BENCHMARK_WILDCARD:
+				prefixMaxLen := *termQueryPrefixMaxLen
+				if (prefixMaxLen - 2) <= *termQueryPrefixMinLen {
+					prefixMaxLen = prefixMaxLen + 2
+					log.Println(fmt.Sprintf("%s needs to be at least larger by 2 than min length given we want the wildcard to be present at the midle of the term. Forcing %s=%d", TERM_QUERY_MAX_LEN, TERM_QUERY_MAX_LEN, prefixMaxLen))
+				}
+				return WildcardBenchmark(queries, benchmarkQueryField, indexes[0], *termQueryPrefixMinLen, prefixMaxLen, *debugLevel)
+			case BENCHMARK_SUFFIX:
+				return SuffixBenchmark(queries, benchmarkQueryField, indexes[0], *termQueryPrefixMinLen, *termQueryPrefixMaxLen, *debugLevel)
+			case BENCHMARK_PREFIX:
+				return PrefixBenchmark(queries, benchmarkQueryField, indexes[0], *termQueryPrefixMinLen, *termQueryPrefixMaxLen, *debugLevel)
+			case BENCHMARK_SEARCH:
+				return SearchBenchmark(queries, benchmarkQueryField, indexes[0], opts, *debugLevel)
+			case BENCHMARK_SEARCH_FILTERED:
+				if *filterWindowRatio <= 0 || *filterWindowRatio > 1 {
+					log.Fatalf("Invalid -filter-window-ratio %g, it needs to be in (0, 1]", *filterWindowRatio)
+				}
+				field := *filterField
+				if field == "" {
+					switch *dataset {
+					case PMC_DATASET:
+						field = "timestamp"
+					case REDDIT_DATASET:
+						field = "date"
+					default:
+						log.Fatalf("The %s benchmark needs a -filter-field on the %s dataset", BENCHMARK_SEARCH_FILTERED, *dataset)
+					}
+				}
+				min, max, err := ingest.ReadNumericRange(*fileName, newDocumentReader(*dataset, "", *randomSeed), indexes[0], 10000, field)
+				if err != nil {
+					log.Fatalf("Failed on the %s range preparation due to %v", field, err)
+				}
+				log.Println(fmt.Sprintf("Filtering %s windows of %g of the [%g, %g] range", field, *filterWindowRatio, min, max))
+				return SearchFilteredBenchmark(queries, benchmarkQueryField, indexes[0], opts, field, min, max, *filterWindowRatio, *debugLevel)
+			case BENCHMARK_GEO:
+				if *geoField == "" {
+					log.Fatalf("The %s benchmark needs the -geo-field of the ingested locations", BENCHMARK_GEO)
+				}
+				locations := synth.NewLocationGenerator(*randomSeed, GEO_MIN_LON, GEO_MIN_LAT, GEO_MAX_LON, GEO_MAX_LAT)
+				return GeoBenchmark(*geoField, indexes[0], locations, *geoRadius, *debugLevel)
+			}
+			return nil
+		}
+		var benchmarkName string
+		var benchmarkFunc func() (string, error)
 		switch *benchmark {
 		case BENCHMARK_CONTAINS:
-			name := fmt.Sprintf("contains: %d terms", len(queries))
+			benchmarkName = fmt.Sprintf("contains: %d terms", len(queries))
 			log.Println("Starting term-level queries benchmark: Type CONTAINS")
-			Benchmark(*conc, duration, &histogramMutex, *engine, name, *outfile, *reportingPeriod, w, ContainsBenchmark(queries, benchmarkQueryField, indexes[0], *termQueryPrefixMinLen, *termQueryPrefixMaxLen, *debugLevel))
+			benchmarkFunc = newQueryBenchmark(*benchmark)
 		case BENCHMARK_WILDCARD:
-			name := fmt.Sprintf("wildcard: %d terms", len(queries))
+			benchmarkName = fmt.Sprintf("wildcard: %d terms", len(queries))
 			log.Println("Starting term-level queries benchmark: Type WILDCARD")
-			prefixMaxLen := *termQueryPrefixMaxLen
-			if (prefixMaxLen - 2) <= *termQueryPrefixMinLen {
-				prefixMaxLen = prefixMaxLen + 2
-				log.Println(fmt.Sprintf("%s needs to be at least larger by 2 than min length given we want the wildcard to be present at the midle of the term. Forcing %s=%d", TERM_QUERY_MAX_LEN, TERM_QUERY_MAX_LEN, prefixMaxLen))
-			}
-			Benchmark(*conc, duration, &histogramMutex, *engine, name, *outfile, *reportingPeriod, w, WildcardBenchmark(queries, benchmarkQueryField, indexes[0], *termQueryPrefixMinLen, prefixMaxLen, *debugLevel))
+			benchmarkFunc = newQueryBenchmark(*benchmark)
 		case BENCHMARK_SUFFIX:
-			name := fmt.Sprintf("suffix: %d terms", len(queries))
+			benchmarkName = fmt.Sprintf("suffix: %d terms", len(queries))
 			log.Println("Starting term-level queries benchmark: Type SUFFIX")
-			Benchmark(*conc, duration, &histogramMutex, *engine, name, *outfile, *reportingPeriod, w, SuffixBenchmark(queries, benchmarkQueryField, indexes[0], *termQueryPrefixMinLen, *termQueryPrefixMaxLen, *debugLevel))
+			benchmarkFunc = newQueryBenchmark(*benchmark)
 		case BENCHMARK_PREFIX:
-			name := fmt.Sprintf("prefix: %d terms", len(queries))
+			benchmarkName = fmt.Sprintf("prefix: %d terms", len(queries))
 			log.Println("Starting term-level queries benchmark: Type PREFIX")
-			Benchmark(*conc, duration, &histogramMutex, *engine, name, *outfile, *reportingPeriod, w, PrefixBenchmark(queries, benchmarkQueryField, indexes[0], *termQueryPrefixMinLen, *termQueryPrefixMaxLen, *debugLevel))
+			benchmarkFunc = newQueryBenchmark(*benchmark)
 		case BENCHMARK_SEARCH:
-			name := fmt.Sprintf("search: %d terms", len(queries))
+			benchmarkName = fmt.Sprintf("search: %d terms", len(queries))
 			log.Println("Starting full-text queries benchmark")
-			Benchmark(*conc, duration, &histogramMutex, *engine, name, *outfile, *reportingPeriod, w, SearchBenchmark(queries, benchmarkQueryField, indexes[0], opts, *debugLevel))
+			benchmarkFunc = newQueryBenchmark(*benchmark)
+		case BENCHMARK_SEARCH_FILTERED:
+			benchmarkName = fmt.Sprintf("search-filtered: %d terms", len(queries))
+			log.Println("Starting full-text queries with numeric range filters benchmark")
+			benchmarkFunc = newQueryBenchmark(*benchmark)
+		case BENCHMARK_GEO:
+			benchmarkName = fmt.Sprintf("geo: %g km radius", *geoRadius)
+			log.Println(fmt.Sprintf("Starting geo-radius queries benchmark: Radius %g km", *geoRadius))
+			benchmarkFunc = newQueryBenchmark(*benchmark)
+		case BENCHMARK_MIXED:
+			weights, err := ParseMixedWeights(*mixedWeights)
+			if err != nil {
+				log.Fatalf("Invalid %s: %v", MIXED_WEIGHTS, err)
+			}
+			benchmarks := map[string]func() (string, error){}
+			for queryType := range weights {
+				if benchmarks[queryType] = newQueryBenchmark(queryType); benchmarks[queryType] == nil {
+					log.Fatalf("Invalid %s: unknown query type %s", MIXED_WEIGHTS, queryType)
+				}
+			}
+			benchmarkName = fmt.Sprintf("mixed %s: %d terms", *mixedWeights, len(queries))
+			log.Println(fmt.Sprintf("Starting mixed queries benchmark: Weights %s", *mixedWeights))
+			benchmarkFunc = MixedBenchmark(benchmarks, weights)
 		default:
 			returnCode = -1
 			fmt.Fprintln(os.Stderr, "No valid benchmark specified")
 		}
+		var writersWg *sync.WaitGroup
+		var writersInput *os.File
+		writersCtx, stopWriters := context.WithCancel(ctx)
+		if benchmarkFunc != nil && *writers > 0 {
+			fp, err := os.Open(*fileName)
+			if err != nil {
+				log.Fatalf("Failed to open the input file for the writers due to %v", err)
+			}
+			writersInput = fp
+			docs := make(chan index.Document, *bulkIndexingSizeDocs)
+			if err = newDocumentReader(*dataset, *geoField, *randomSeed).Read(fp, docs, int(*maxDocPerIndex), idx); err != nil {
+				log.Fatalf("Failed to read the documents for the writers due to %v", err)
+			}
+			log.Println(fmt.Sprintf("Indexing documents with %d writers while running the benchmark", *writers))
+			writersWg = RunWriters(writersCtx, *writers, *warmup+duration, *writersMaxRps, docs, idx, redisearch.IndexingOptions{}, &histogramMutex)
+		}
+		if benchmarkFunc != nil {
+			err = Benchmark(ctx, *conc, duration, *warmup, *maxRps, *errorBudget, &histogramMutex, *engine, benchmarkName, dbConfigs, *outfile, *reportingPeriod, w, benchmarkFunc)
+			if err != nil {
+				returnCode = 1
+			}
+		}
+		stopWriters()
+		if writersWg != nil {
+			writersWg.Wait()
+			writersInput.Close()
+		}
+		if err = idx.Close(); err != nil {
+			log.Println(fmt.Sprintf("Failed to close the index due to %v", err))
+			returnCode = 1
+		}
 		os.Exit(returnCode)
 
 	} else {
@@ -246,19 +431,15 @@ func main() {
 		if err != nil {
 			panic(err)
 		}
-		var reader ingest.DocumentReader
-
-		switch *dataset {
-		case EN_WIKI_DATASET:
-			reader = &ingest.WikipediaAbstractsReader{}
-		case REDDIT_DATASET:
-			reader = &ingest.RedditReader{}
-		case PMC_DATASET:
-			reader = &ingest.PmcReader{}
-		}
-		err = ingest.ReadFile(*fileName, reader, idx, redisearch.IndexingOptions{}, *bulkIndexingSizeDocs, *maxDocPerIndex, *conc)
+		reader := newDocumentReader(*dataset, *geoField, *randomSeed)
+		err = IngestionBenchmark(*fileName, reader, idx, redisearch.IndexingOptions{}, *bulkIndexingSizeDocs, *maxDocPerIndex, *conc, &histogramMutex, dbConfigs, *outfile, *reportingPeriod)
 
 		if *maxDocPerIndex > 0 {
+			if redisIdx, ok := idx.(*redisearch.Index); ok {
+				if waitErr := redisIdx.WaitForIndexing(*redisIndexingTimeout); waitErr != nil {
+					log.Println(fmt.Sprintf("Failed to wait for the background indexing due to %v", waitErr))
+				}
+			}
 			ndocs := idx.DocumentCount()
 			if ndocs != *maxDocPerIndex {
 				fmt.Fprintln(os.Stderr, fmt.Sprintf("Expected %d documents in the index, but got %d.", *maxDocPerIndex, ndocs))
@@ -267,6 +448,9 @@ func main() {
 				log.Println(fmt.Sprintf("Confirmed that the index total documents is the expected value %d=%d", ndocs, *maxDocPerIndex))
 			}
 		}
+		if closeErr := idx.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
 		if err != nil {
 			panic(err)
 		}
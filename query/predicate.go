@@ -1,9 +1,14 @@
 package query
 
+import "fmt"
+
 type Operator string
 
 const (
 	Eq Operator = "="
+	In Operator = "IN"
+
+	GeoRadius Operator = "GEO_RADIUS"
 
 	Gt  Operator = ">"
 	Gte Operator = ">="
@@ -11,8 +16,14 @@ const (
 	Lt  Operator = "<"
 	Lte Operator = "<="
 
-	Between          Operator = "BETWEEN"
-	BetweenInclusive Operator = "BETWEEEN_EXCLUSIVE"
+	// min <= x <= max
+	BetweenInclusive Operator = "BETWEEN_INCLUSIVE"
+	// min < x < max
+	BetweenExclusive Operator = "BETWEEN_EXCLUSIVE"
+	// min <= x < max
+	BetweenMinInclusive Operator = "BETWEEN_MIN_INCLUSIVE"
+	// min < x <= max
+	BetweenMaxInclusive Operator = "BETWEEN_MAX_INCLUSIVE"
 )
 
 type Predicate struct {
@@ -33,13 +44,35 @@ func Equals(property string, value interface{}) Predicate {
 
 }
 
+// IsIn matches the documents where property has any of the given values
+func IsIn(property string, values ...interface{}) Predicate {
+	return NewPredicate(property, In, values...)
+}
+
+// WithinRadius matches the documents where the location in property is at most radiusKm kilometers away from the
+// lon, lat point
+func WithinRadius(property string, lon, lat, radiusKm float64) Predicate {
+	return NewPredicate(property, GeoRadius, lon, lat, radiusKm)
+}
+
+// InRange matches the documents where property is between min and max, both bounds being either inclusive or
+// exclusive
 func InRange(property string, min, max interface{}, inclusive bool) Predicate {
-	operator := Between
-	if inclusive {
+	return NewRange(property, min, max, inclusive, inclusive)
+}
+
+// NewRange matches the documents where property is between min and max, with each bound inclusive or exclusive
+func NewRange(property string, min, max interface{}, minInclusive, maxInclusive bool) Predicate {
+	operator := BetweenExclusive
+	switch {
+	case minInclusive && maxInclusive:
 		operator = BetweenInclusive
+	case minInclusive:
+		operator = BetweenMinInclusive
+	case maxInclusive:
+		operator = BetweenMaxInclusive
 	}
 	return NewPredicate(property, operator, min, max)
-
 }
 
 func LessThan(property string, value interface{}) Predicate {
@@ -57,3 +90,109 @@ func GreaterThan(property string, value interface{}) Predicate {
 func GreaterThanEquals(property string, value interface{}) Predicate {
 	return NewPredicate(property, Gte, value)
 }
+
+// Validate checks that the predicate has the number and types of values its operator expects, and that the min
+// of a range is not greater than its max
+func (p Predicate) Validate() error {
+	values := 1
+	switch p.Operator {
+	case Eq:
+	case In:
+		if len(p.Value) == 0 {
+			return fmt.Errorf("predicate %s on %s expects at least one value", p.Operator, p.Property)
+		}
+		return nil
+	case GeoRadius:
+		values = 3
+	case Gt, Gte, Lt, Lte:
+	case BetweenInclusive, BetweenExclusive, BetweenMinInclusive, BetweenMaxInclusive:
+		values = 2
+	default:
+		return fmt.Errorf("predicate on %s has unknown operator %s", p.Property, p.Operator)
+	}
+	if len(p.Value) != values {
+		return fmt.Errorf("predicate %s on %s expects %d values, got %d", p.Operator, p.Property, values, len(p.Value))
+	}
+	if p.Operator == Eq {
+		return nil
+	}
+	numbers := make([]float64, 0, len(p.Value))
+	for _, v := range p.Value {
+		f, ok := toFloat(v)
+		if !ok {
+			return fmt.Errorf("predicate %s on %s expects numeric values, got %v (%T)", p.Operator, p.Property, v, v)
+		}
+		numbers = append(numbers, f)
+	}
+	if values == 2 && numbers[0] > numbers[1] {
+		return fmt.Errorf("predicate %s on %s has min %v greater than max %v", p.Operator, p.Property, p.Value[0], p.Value[1])
+	}
+	if p.Operator == GeoRadius && numbers[2] < 0 {
+		return fmt.Errorf("predicate %s on %s has negative radius %v", p.Operator, p.Property, p.Value[2])
+	}
+	return nil
+}
+
+// toFloat returns the value of a numeric type as a float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// Range returns the bounds of a numeric range predicate, and whether each bound is inclusive. A nil bound means
+// the range is unbounded on that side. Equality is the range with both inclusive bounds set to the value.
+func (p Predicate) Range() (min, max interface{}, minInclusive, maxInclusive bool, err error) {
+	if err = p.Validate(); err != nil {
+		return
+	}
+	switch p.Operator {
+	case Eq:
+		if _, ok := toFloat(p.Value[0]); !ok {
+			err = fmt.Errorf("predicate %s on %s expects a numeric value, got %v (%T)", p.Operator, p.Property, p.Value[0], p.Value[0])
+			return
+		}
+		return p.Value[0], p.Value[0], true, true, nil
+	case Gt:
+		return p.Value[0], nil, false, false, nil
+	case Gte:
+		return p.Value[0], nil, true, false, nil
+	case Lt:
+		return nil, p.Value[0], false, false, nil
+	case Lte:
+		return nil, p.Value[0], false, true, nil
+	case BetweenInclusive:
+		return p.Value[0], p.Value[1], true, true, nil
+	case BetweenExclusive:
+		return p.Value[0], p.Value[1], false, false, nil
+	case BetweenMinInclusive:
+		return p.Value[0], p.Value[1], true, false, nil
+	case BetweenMaxInclusive:
+		return p.Value[0], p.Value[1], false, true, nil
+	}
+	return nil, nil, false, false, fmt.Errorf("predicate %s on %s is not a range", p.Operator, p.Property)
+}
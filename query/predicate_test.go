@@ -0,0 +1,70 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPredicateValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		predicate Predicate
+		valid     bool
+	}{
+		{"equals", Equals("sub", "golang"), true},
+		{"in", IsIn("sub", "golang", "rust"), true},
+		{"in without values", IsIn("sub"), false},
+		{"greater than", GreaterThan("ts", 10), true},
+		{"greater than string", GreaterThan("ts", "10"), false},
+		{"inclusive range", InRange("ts", 10, 20, true), true},
+		{"exclusive range", InRange("ts", int64(10), 20.5, false), true},
+		{"empty range", NewRange("ts", 10, 10, true, false), true},
+		{"min greater than max", NewRange("ts", 20, 10, true, false), false},
+		{"range with a single value", NewPredicate("ts", BetweenInclusive, 10), false},
+		{"geo radius", WithinRadius("location", 2.35, 48.85, 10), true},
+		{"negative radius", WithinRadius("location", 2.35, 48.85, -1), false},
+		{"unknown operator", NewPredicate("ts", "LIKE", 10), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.predicate.Validate()
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestPredicateRange(t *testing.T) {
+	tests := []struct {
+		predicate    Predicate
+		min, max     interface{}
+		minInclusive bool
+		maxInclusive bool
+	}{
+		{Equals("ts", 10), 10, 10, true, true},
+		{GreaterThan("ts", 10), 10, nil, false, false},
+		{GreaterThanEquals("ts", 10), 10, nil, true, false},
+		{LessThan("ts", 20), nil, 20, false, false},
+		{LessThanEquals("ts", 20), nil, 20, false, true},
+		{NewRange("ts", 10, 20, true, true), 10, 20, true, true},
+		{NewRange("ts", 10, 20, false, false), 10, 20, false, false},
+		{NewRange("ts", 10, 20, true, false), 10, 20, true, false},
+		{NewRange("ts", 10, 20, false, true), 10, 20, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.predicate.Operator), func(t *testing.T) {
+			min, max, minInclusive, maxInclusive, err := tt.predicate.Range()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.min, min)
+			assert.Equal(t, tt.max, max)
+			assert.Equal(t, tt.minInclusive, minInclusive)
+			assert.Equal(t, tt.maxInclusive, maxInclusive)
+		})
+	}
+	_, _, _, _, err := Equals("sub", "golang").Range()
+	assert.Error(t, err)
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"github.com/HdrHistogram/hdrhistogram-go"
+	"sort"
+	"sync"
 	"sync/atomic"
 	"text/tabwriter"
 	"time"
@@ -16,8 +18,56 @@ const (
 // the total time it took to run the functions, to measure average latency, in nanoseconds
 var totalTime uint64
 var totalOps uint64
+var totalErrors uint64
+
+// the number of documents and their estimated size in bytes indexed by an ingestion
+var totalDocs uint64
+var totalBytes uint64
+
+// the number of documents that failed to be indexed by the writers running alongside the query benchmark
+var totalWriteErrors uint64
 var totalHistogram *hdrhistogram.Histogram
 
+// latencies measured from the moment each request was actually sent, only kept when running at a fixed rate.
+// totalHistogram then holds the latencies measured from the intended send time of each request
+var uncorrectedHistogram *hdrhistogram.Histogram
+
+// the latencies of each command, keyed by the command name. Guarded by histogramMutex
+var commandHistograms = map[string]*hdrhistogram.Histogram{}
+
+// latencies of the current reporting period. It is swapped with an empty histogram by the report go-routine on every tick
+var intervalHistogram *hdrhistogram.Histogram
+
+// the per reporting period datapoints collected by the report go-routine
+var timeSeries []DataPoint
+var timeSeriesMutex sync.Mutex
+
+// resetStats resets the histograms, counters and datapoints of the benchmark, enabling the uncorrected histogram
+// when the requests are issued at a fixed rate
+func resetStats(fixedRate bool) {
+	histogramMutex.Lock()
+	totalHistogram = hdrhistogram.New(1, 1000000000, 3)
+	intervalHistogram = hdrhistogram.New(1, 1000000000, 3)
+	commandHistograms = map[string]*hdrhistogram.Histogram{}
+	uncorrectedHistogram = nil
+	if fixedRate {
+		uncorrectedHistogram = hdrhistogram.New(1, 1000000000, 3)
+	}
+	histogramMutex.Unlock()
+	atomic.StoreUint64(&totalOps, 0)
+	atomic.StoreUint64(&totalTime, 0)
+	atomic.StoreUint64(&totalErrors, 0)
+	atomic.StoreUint64(&totalWriteErrors, 0)
+	atomic.StoreUint64(&totalDocs, 0)
+	atomic.StoreUint64(&totalBytes, 0)
+	for _, counter := range errorCounters {
+		atomic.StoreUint64(counter, 0)
+	}
+	timeSeriesMutex.Lock()
+	timeSeries = nil
+	timeSeriesMutex.Unlock()
+}
+
 func GetOverallRatesMap(took time.Duration) map[string]interface{} {
 	/////////
 	// Overall Rates
@@ -25,6 +75,39 @@ func GetOverallRatesMap(took time.Duration) map[string]interface{} {
 	configs := map[string]interface{}{}
 	overallOpsRate := calculateRateMetrics(totalOps, 0, took)
 	configs["overallOpsRate"] = overallOpsRate
+	overallErrorsRate := calculateRateMetrics(totalErrors, 0, took)
+	configs["overallErrorsRate"] = overallErrorsRate
+	histogramMutex.Lock()
+	for command, histogram := range commandHistograms {
+		configs[command] = calculateRateMetrics(uint64(histogram.TotalCount()), 0, took)
+	}
+	histogramMutex.Unlock()
+	return configs
+}
+
+// recordCommandLatency records a latency in microseconds in the histogram of the given command, registering the
+// command on its first use. The caller needs to hold histogramMutex
+func recordCommandLatency(command string, latency int64) error {
+	histogram, found := commandHistograms[command]
+	if !found {
+		histogram = hdrhistogram.New(1, 1000000000, 3)
+		commandHistograms[command] = histogram
+	}
+	return histogram.RecordValue(latency)
+}
+
+func GetTotals() map[string]interface{} {
+	configs := map[string]interface{}{}
+	configs["totalOps"] = totalOps
+	configs["totalErrors"] = totalErrors
+	// the ratio of failed requests from all the issued requests
+	errorsRatio := 0.0
+	if totalOps+totalErrors > 0 {
+		errorsRatio = float64(totalErrors) / float64(totalOps+totalErrors)
+	}
+	configs["errorsRatio"] = errorsRatio
+	configs["errors"] = GetErrorTotals()
+	configs["totalWriteErrors"] = atomic.LoadUint64(&totalWriteErrors)
 	return configs
 }
 
@@ -53,6 +136,28 @@ func GetOverallQuantiles() map[string]interface{} {
 	configs := map[string]interface{}{}
 	_, all := generateQuantileMap(totalHistogram)
 	configs["allCommands"] = all
+	if uncorrectedHistogram != nil {
+		_, uncorrected := generateQuantileMap(uncorrectedHistogram)
+		configs["allCommandsUncorrected"] = uncorrected
+	}
+	histogramMutex.Lock()
+	for command, histogram := range commandHistograms {
+		_, quantiles := generateQuantileMap(histogram)
+		configs[command] = quantiles
+	}
+	histogramMutex.Unlock()
+	return configs
+}
+
+// GetTimeSeries returns the datapoints collected by the report go-routine, sorted by timestamp
+func GetTimeSeries() map[string]interface{} {
+	timeSeriesMutex.Lock()
+	datapoints := make([]DataPoint, len(timeSeries))
+	copy(datapoints, timeSeries)
+	timeSeriesMutex.Unlock()
+	sort.Sort(ByTimestamp(datapoints))
+	configs := map[string]interface{}{}
+	configs["allCommands"] = datapoints
 	return configs
 }
 
@@ -61,29 +166,107 @@ func calculateRateMetrics(current, prev uint64, took time.Duration) (rate float6
 	return
 }
 
-// report handles periodic reporting of loading stats
-func report(period time.Duration, start, end time.Time, w *tabwriter.Writer) {
+// report handles periodic reporting of loading stats, and stores a datapoint with the throughput, latency and errors
+// of each reporting period. It returns once done is closed.
+func report(period time.Duration, start, end time.Time, w *tabwriter.Writer, done <-chan struct{}) {
 	prevTime := start
 	prevTotalOps := uint64(0)
+	prevTotalErrors := uint64(0)
 	totalDuration := end.Sub(start)
 	totalDurationMs := float64(totalDuration.Milliseconds())
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	// swapped with intervalHistogram on every tick
+	spareHistogram := hdrhistogram.New(1, 1000000000, 3)
 
-	fmt.Printf("%26s %7s %25s %25s %25s\n", "Test time", " ", "Command Rate", "Client p50 with RTT(ms)", "Total Commands")
-	for now := range time.NewTicker(period).C {
+	fmt.Printf("%26s %7s %25s %25s %25s %25s\n", "Test time", " ", "Command Rate", "Client p50 with RTT(ms)", "Client p99 with RTT(ms)", "Total Commands")
+	for {
+		var now time.Time
+		select {
+		case <-done:
+			return
+		case now = <-ticker.C:
+		}
 
 		took := now.Sub(prevTime)
 		tookTotal := end.Sub(now)
 		currentCount := atomic.LoadUint64(&totalOps)
+		currentErrors := atomic.LoadUint64(&totalErrors)
 		completionPercent := (totalDurationMs - float64(tookTotal.Milliseconds())) / totalDurationMs * 100.0
 		completionPercentStr := fmt.Sprintf("[%3.1f%%]", completionPercent)
 
 		opsRate := calculateRateMetrics((currentCount), prevTotalOps, took)
-		histogramMutex.Lock()
-		instantP50 := float64(totalHistogram.ValueAtQuantile(50.0)) / 10e2
-		histogramMutex.Unlock()
-		fmt.Printf("%25.0fs %7s %25.2f %25.3f %25d", time.Since(start).Seconds(), completionPercentStr, opsRate, instantP50, currentCount)
+		var intervalQuantiles map[string]float64
+		intervalQuantiles, spareHistogram = swapIntervalHistogram(spareHistogram)
+
+		datapoint := NewDataPoint(now.UnixMilli())
+		datapoint.AddValue("opsRate", opsRate)
+		datapoint.AddValue("errors", float64(currentErrors-prevTotalErrors))
+		storeDataPoint(datapoint, intervalQuantiles)
+
+		fmt.Printf("%25.0fs %7s %25.2f %25.3f %25.3f %25d", time.Since(start).Seconds(), completionPercentStr, opsRate, intervalQuantiles["q50"], intervalQuantiles["q99"], currentCount)
 		fmt.Printf("\r")
 		prevTotalOps = (currentCount)
+		prevTotalErrors = currentErrors
 		prevTime = now
 	}
 }
+
+// reportIngestion stores a datapoint with the indexed documents and bytes rates, the batches latency and the errors
+// of each reporting period of an ingestion. It returns once done is closed.
+func reportIngestion(period time.Duration, start time.Time, done <-chan struct{}) {
+	prevTime := start
+	prevTotalDocs := uint64(0)
+	prevTotalBytes := uint64(0)
+	prevTotalErrors := uint64(0)
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	spareHistogram := hdrhistogram.New(1, 1000000000, 3)
+	for {
+		var now time.Time
+		select {
+		case <-done:
+			return
+		case now = <-ticker.C:
+		}
+		took := now.Sub(prevTime)
+		currentDocs := atomic.LoadUint64(&totalDocs)
+		currentBytes := atomic.LoadUint64(&totalBytes)
+		currentErrors := atomic.LoadUint64(&totalErrors)
+		var intervalQuantiles map[string]float64
+		intervalQuantiles, spareHistogram = swapIntervalHistogram(spareHistogram)
+
+		datapoint := NewDataPoint(now.UnixMilli())
+		datapoint.AddValue("docsRate", calculateRateMetrics(currentDocs, prevTotalDocs, took))
+		datapoint.AddValue("bytesRate", calculateRateMetrics(currentBytes, prevTotalBytes, took))
+		datapoint.AddValue("errors", float64(currentErrors-prevTotalErrors))
+		storeDataPoint(datapoint, intervalQuantiles)
+		prevTotalDocs = currentDocs
+		prevTotalBytes = currentBytes
+		prevTotalErrors = currentErrors
+		prevTime = now
+	}
+}
+
+// swapIntervalHistogram replaces the interval histogram with spare, so that the workers don't wait for the quantiles
+// calculation. It returns the quantiles of the replaced histogram, and the replaced histogram reset to be used as the
+// next spare
+func swapIntervalHistogram(spare *hdrhistogram.Histogram) (map[string]float64, *hdrhistogram.Histogram) {
+	histogramMutex.Lock()
+	current := intervalHistogram
+	intervalHistogram = spare
+	histogramMutex.Unlock()
+	_, quantiles := generateQuantileMap(current)
+	current.Reset()
+	return quantiles, current
+}
+
+// storeDataPoint adds the latency quantiles to the datapoint, and appends it to the time-series
+func storeDataPoint(datapoint *DataPoint, quantiles map[string]float64) {
+	for quantile, value := range quantiles {
+		datapoint.AddValue(quantile, value)
+	}
+	timeSeriesMutex.Lock()
+	timeSeries = append(timeSeries, *datapoint)
+	timeSeriesMutex.Unlock()
+}
@@ -16,6 +16,16 @@ func TestDocumentGenerator(t *testing.T) {
 	}
 }
 
+func TestLocationGenerator(t *testing.T) {
+	g := NewLocationGenerator(12345, -10, 35, 30, 60)
+	for i := 0; i < 100; i++ {
+		p := g.Generate()
+		if p.Lon < -10 || p.Lon > 30 || p.Lat < 35 || p.Lat > 60 {
+			t.Errorf("location %v out of the bounding box", p)
+		}
+	}
+}
+
 func BenchmarkGenerator(b *testing.B) {
 	g := NewDocumentGenerator(1000, map[string][2]int{"title": {10, 15}})
 	for i := 0; i < b.N; i++ {
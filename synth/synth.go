@@ -2,6 +2,7 @@ package synth
 
 import (
 	"math/rand"
+	"sync"
 
 	"fmt"
 
@@ -59,3 +60,33 @@ func (g *DocumentGenerator) Generate(docId int) index.Document {
 	// }
 	return doc
 }
+
+// LocationGenerator generates synthetic locations, uniformly distributed in a bounding box. It is safe for
+// concurrent use
+type LocationGenerator struct {
+	sync.Mutex
+	minLon, minLat, maxLon, maxLat float64
+
+	rng *rand.Rand
+}
+
+// NewLocationGenerator creates a generator of locations in the box between the min and max longitudes and latitudes
+func NewLocationGenerator(seed int64, minLon, minLat, maxLon, maxLat float64) *LocationGenerator {
+	return &LocationGenerator{
+		minLon: minLon,
+		minLat: minLat,
+		maxLon: maxLon,
+		maxLat: maxLat,
+		rng:    rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Generate generates a synthetic location
+func (g *LocationGenerator) Generate() index.GeoPoint {
+	g.Lock()
+	defer g.Unlock()
+	return index.GeoPoint{
+		Lon: g.minLon + g.rng.Float64()*(g.maxLon-g.minLon),
+		Lat: g.minLat + g.rng.Float64()*(g.maxLat-g.minLat),
+	}
+}
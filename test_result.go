@@ -30,6 +30,14 @@ type TestResult struct {
 	Workers             uint   `json:"Workers"`
 	MaxRps              int64  `json:"MaxRps"`
 
+	// Duration of the warm-up phase that preceded the measurements, and is excluded from the results
+	WarmupDurationMillis int64 `json:"WarmupDurationMillis"`
+
+	// Whether the benchmark was stopped before the end of its duration, making these partial results
+	Interrupted bool `json:"Interrupted"`
+	// Why the benchmark was aborted before the end of its duration, like an exceeded error budget. Empty unless aborted
+	AbortReason string `json:"AbortReason,omitempty"`
+
 	// DB Spefic Configs
 	DBSpecificConfigs map[string]interface{} `json:"DBSpecificConfigs"`
 